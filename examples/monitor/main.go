@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/identity"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/networks"
+)
+
+func main() {
+	peers := os.Args[1:]
+	if len(peers) == 0 {
+		log.Fatal("Usage: monitor <host[:port]>...")
+	}
+
+	monitor, err := p2p.NewMonitor(
+		networks.Mainnet,
+		peers,
+		identity.NewFileProvider("identity.json", identity.DefaultDifficulty),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-stop
+		log.Print("[!] Ctrl+C pressed in Terminal")
+		monitor.Stop()
+	}()
+
+	tracker := p2p.NewPropagationTracker(100)
+
+	monitor.Start()
+	for update := range monitor.Updates() {
+		if tracker.Record(update) {
+			log.Printf("%s %s: head %s at level %d", update.ReceivedAt.Format("15:04:05.000"), update.Address.String(), update.Hash, update.Head.CurrentBlockHeader.Level)
+		}
+	}
+
+	for _, block := range tracker.Blocks() {
+		log.Printf("Block %s at level %d: %d peers, median %s, p90 %s", block.Hash, block.Level, len(block.Announcements), block.Median, block.P90)
+		for _, straggler := range block.Stragglers {
+			log.Printf("  straggler %s: %s", straggler.Address.String(), straggler.Delay)
+		}
+	}
+	log.Print("Stopped")
+}
@@ -9,13 +9,22 @@ import (
 )
 
 type config struct {
+	Network   string   `yaml:"network"`
 	Bootstrap []string `yaml:"bootstrap"`
 	Attempts  struct {
 		Count   int64 `yaml:"count"`
 		Timeout int64 `yaml:"timeout"`
 	}
-	SyncedTime   int64 `yaml:"synced_time"`
-	ThreadsCount int64 `yaml:"threads_count"`
+	Timeouts struct {
+		Dial      int64 `yaml:"dial"`
+		Handshake int64 `yaml:"handshake"`
+		Read      int64 `yaml:"read"`
+		Write     int64 `yaml:"write"`
+	}
+	PrivateNode  bool   `yaml:"private_node"`
+	Proxy        string `yaml:"proxy"`
+	SyncedTime   int64  `yaml:"synced_time"`
+	ThreadsCount int64  `yaml:"threads_count"`
 }
 
 func getConfig(filename string) (c config, err error) {
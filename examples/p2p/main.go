@@ -9,9 +9,13 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/aopoltorzhicky/tezos-scanner/p2p"
-	"github.com/aopoltorzhicky/tezos-scanner/p2p/ffi"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/dialer"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/identity"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/networks"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
 )
 
 func main() {
@@ -20,17 +24,33 @@ func main() {
 		panic(err)
 	}
 
-	identity, err := ffi.GetIdentity()
+	network, err := networks.Get(cfg.Network)
 	if err != nil {
 		panic(err)
 	}
+
+	connections := dialer.Direct()
+	if cfg.Proxy != "" {
+		connections = dialer.NewSOCKS5(cfg.Proxy, nil)
+	}
+
 	scanner, err := p2p.NewScanner(
+		network,
 		cfg.Bootstrap,
-		identity,
+		identity.NewFileProvider("identity.json", identity.DefaultDifficulty),
+		p2p.WithDialer(connections),
 		p2p.WithAttemptsDuration(cfg.Attempts.Timeout),
 		p2p.WithDropAfter(cfg.Attempts.Count),
 		p2p.WithSyncedTime(cfg.SyncedTime),
 		p2p.WithThreadsCount(cfg.ThreadsCount),
+		p2p.WithProofOfWorkCheck(protocol.ProofOfWorkRecord, protocol.DefaultProofOfWorkDifficulty),
+		p2p.WithTimeouts(
+			time.Duration(cfg.Timeouts.Dial)*time.Second,
+			time.Duration(cfg.Timeouts.Handshake)*time.Second,
+			time.Duration(cfg.Timeouts.Read)*time.Second,
+			time.Duration(cfg.Timeouts.Write)*time.Second,
+		),
+		p2p.WithPrivateNode(cfg.PrivateNode),
 	)
 	if err != nil {
 		panic(err)
@@ -45,7 +65,7 @@ func main() {
 	}()
 
 	header := [][]string{
-		{"ip", "port", "id", "private", "rpc", "synced", "disable_mempool", "neighbors", "versions"},
+		{"ip", "port", "id", "private", "rpc", "synced", "disable_mempool", "neighbors", "versions", "pow_difficulty", "head", "level", "round"},
 	}
 
 	recordFile, err := os.Create("peers.csv")
@@ -84,6 +104,15 @@ func main() {
 				neighbors[i] = host
 			}
 
+			var head, level, round string
+			if peer.Head != nil {
+				head = peer.Head.String()
+				level = strconv.FormatUint(uint64(peer.Level), 10)
+			}
+			if fitness, err := peer.Fitness.Decode(); err == nil && fitness.Version == protocol.FitnessVersionTenderbake {
+				round = strconv.FormatInt(int64(fitness.Round), 10)
+			}
+
 			row := [][]string{
 				{
 					peer.Address.IP.String(),
@@ -95,6 +124,10 @@ func main() {
 					strconv.FormatBool(peer.DisableMempool),
 					strings.Join(neighbors, "|"),
 					strings.Join(versions, "|"),
+					strconv.FormatFloat(peer.ProofOfWorkDifficulty, 'f', 2, 64),
+					head,
+					level,
+					round,
 				},
 			}
 			if err = writer.WriteAll(row); err != nil {
@@ -103,6 +136,12 @@ func main() {
 		}
 	}
 
+	for head, peers := range scanner.Heads() {
+		log.Printf("Head %s: %d peers", head, len(peers))
+	}
+	if head, peers, ok := scanner.HeaviestHead(); ok {
+		log.Printf("Heaviest head %s at level %d: %d peers", head, peers[0].Level, len(peers))
+	}
 	log.Print("Stopped")
 	close(stop)
 }
@@ -14,7 +14,7 @@ func main() {
 		"https://mainnet.smartpy.io",
 	}
 
-	network := scanner.NewNetwork("NetXdQprcVkpaWU")
+	network := scanner.NewNetwork(scanner.Mainnet)
 	network.Init(bootstrap)
 
 	if err := network.Scan(); err != nil {
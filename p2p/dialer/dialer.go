@@ -0,0 +1,71 @@
+package dialer
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Dialer - establishes outgoing connections. It's implemented by net.Dialer and by dialers of the package.
+// Timeouts are set by the context of the call.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Direct - dials from the host without proxy.
+func Direct() Dialer {
+	return &net.Dialer{}
+}
+
+// FromSource - dials directly from the local address. The address has to belong to the host
+// and to be of the same family as dialed addresses.
+func FromSource(ip net.IP) Dialer {
+	return &net.Dialer{
+		LocalAddr: &net.TCPAddr{IP: ip},
+	}
+}
+
+// RoundRobin - spreads connections between dialers in turn.
+type RoundRobin struct {
+	dialers []Dialer
+	next    uint64
+}
+
+// NewRoundRobin - creates round-robin pool. It panics if dialers are empty.
+func NewRoundRobin(dialers ...Dialer) *RoundRobin {
+	if len(dialers) == 0 {
+		panic("dialer: empty round-robin pool")
+	}
+	return &RoundRobin{
+		dialers: dialers,
+	}
+}
+
+// NewSourcePool - creates round-robin pool which dials from the local addresses in turn.
+func NewSourcePool(ips ...net.IP) *RoundRobin {
+	dialers := make([]Dialer, 0, len(ips))
+	for _, ip := range ips {
+		dialers = append(dialers, FromSource(ip))
+	}
+	return NewRoundRobin(dialers...)
+}
+
+// DialContext -
+func (pool *RoundRobin) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	index := (atomic.AddUint64(&pool.next, 1) - 1) % uint64(len(pool.dialers))
+	return pool.dialers[index].DialContext(ctx, network, address)
+}
+
+// HTTPClient - returns HTTP client which connects through the dialer. Connections aren't reused,
+// so every request may leave through another member of a pool.
+func HTTPClient(dialer Dialer, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:       dialer.DialContext,
+			DisableKeepAlives: true,
+		},
+	}
+}
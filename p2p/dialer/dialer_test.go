@@ -0,0 +1,317 @@
+package dialer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveSOCKS5 - accepts one connection, checks the credentials if auth is set and connects it to the requested address.
+func serveSOCKS5(t *testing.T, listener net.Listener, auth *Auth, requested chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Errorf("greeting: %s", err)
+		return
+	}
+	if auth == nil {
+		conn.Write([]byte{socksVersion, socksAuthNone})
+	} else {
+		conn.Write([]byte{socksVersion, socksAuthPassword})
+		data := make([]byte, 2)
+		io.ReadFull(conn, data)
+		username := make([]byte, data[1])
+		io.ReadFull(conn, username)
+		io.ReadFull(conn, data[:1])
+		password := make([]byte, data[0])
+		io.ReadFull(conn, password)
+		if string(username) != auth.Username || string(password) != auth.Password {
+			conn.Write([]byte{0x01, 0x01})
+			return
+		}
+		conn.Write([]byte{0x01, socksPasswordOK})
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		t.Errorf("request: %s", err)
+		return
+	}
+	var host string
+	switch request[3] {
+	case socksAddressIPv4:
+		ip := make([]byte, net.IPv4len)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case socksAddressDomain:
+		length := make([]byte, 1)
+		io.ReadFull(conn, length)
+		name := make([]byte, length[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	}
+	port := make([]byte, 2)
+	io.ReadFull(conn, port)
+	address := net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1])))
+	requested <- address
+
+	target, err := net.Dial("tcp", address)
+	if err != nil {
+		conn.Write([]byte{socksVersion, 0x05, 0x00, socksAddressIPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte{socksVersion, socksReplySucceeded, 0x00, socksAddressIPv4, 127, 0, 0, 1, 0, 0})
+
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func newEchoServer(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener
+}
+
+func TestSOCKS5(t *testing.T) {
+	echo := newEchoServer(t)
+	defer echo.Close()
+
+	tests := []struct {
+		name       string
+		serverAuth *Auth
+		clientAuth *Auth
+		wantErr    bool
+	}{
+		{name: "no auth"},
+		{name: "password", serverAuth: &Auth{"user", "secret"}, clientAuth: &Auth{"user", "secret"}},
+		{name: "wrong password", serverAuth: &Auth{"user", "secret"}, clientAuth: &Auth{"user", "wrong"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer proxy.Close()
+			requested := make(chan string, 1)
+			go serveSOCKS5(t, proxy, tt.serverAuth, requested)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			conn, err := NewSOCKS5(proxy.Addr().String(), tt.clientAuth).DialContext(ctx, "tcp", echo.Addr().String())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			if address := <-requested; address != echo.Addr().String() {
+				t.Errorf("%s != %s", address, echo.Addr().String())
+			}
+			if _, err := conn.Write([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			reply := make([]byte, 4)
+			if _, err := io.ReadFull(conn, reply); err != nil {
+				t.Fatal(err)
+			}
+			if string(reply) != "ping" {
+				t.Errorf("%s != ping", reply)
+			}
+		})
+	}
+}
+
+func TestSOCKS5Cancel(t *testing.T) {
+	// the proxy accepts the connection and keeps silence
+	proxy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = NewTor(proxy.Addr().String(), true).DialContext(ctx, "tcp", "example.com:9732")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("%v != %v", err, context.Canceled)
+	}
+}
+
+// serveSOCKS5Reply - accepts one connection without authentication, sends the request to the channel
+// and answers it with the reply. The greeting of the tunnel is written after the successful reply.
+func serveSOCKS5Reply(t *testing.T, listener net.Listener, reply []byte, requested chan<- []byte) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if _, err := io.ReadFull(conn, make([]byte, 3)); err != nil {
+		t.Errorf("greeting: %s", err)
+		return
+	}
+	conn.Write([]byte{socksVersion, socksAuthNone})
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		t.Errorf("request: %s", err)
+		return
+	}
+	var size int
+	switch request[3] {
+	case socksAddressIPv4:
+		size = net.IPv4len
+	case socksAddressIPv6:
+		size = net.IPv6len
+	case socksAddressDomain:
+		length := make([]byte, 1)
+		io.ReadFull(conn, length)
+		request = append(request, length[0])
+		size = int(length[0])
+	}
+	address := make([]byte, size+2)
+	if _, err := io.ReadFull(conn, address); err != nil {
+		t.Errorf("request address: %s", err)
+		return
+	}
+	requested <- append(request, address...)
+
+	conn.Write(reply)
+	if reply[1] == socksReplySucceeded {
+		conn.Write([]byte("hello"))
+	}
+	io.Copy(io.Discard, conn)
+}
+
+func TestSOCKS5Replies(t *testing.T) {
+	for code := byte(0x01); code <= 0x09; code++ {
+		proxy, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		requested := make(chan []byte, 1)
+		go serveSOCKS5Reply(t, proxy, []byte{socksVersion, code, 0x00, socksAddressIPv4, 0, 0, 0, 0, 0, 0}, requested)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		conn, err := NewSOCKS5(proxy.Addr().String(), nil).DialContext(ctx, "tcp", "10.0.0.1:9732")
+		cancel()
+		proxy.Close()
+
+		if err == nil {
+			conn.Close()
+			t.Errorf("reply %#x: connection is established", code)
+			continue
+		}
+		expected, ok := socksReplies[code]
+		if !ok {
+			expected = fmt.Sprintf("request failed with code %d", code)
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("reply %#x: %q doesn't contain %q", code, err, expected)
+		}
+	}
+}
+
+func TestSOCKS5DomainAddress(t *testing.T) {
+	tests := []struct {
+		name  string
+		bound []byte
+	}{
+		{"ipv4 bound", []byte{socksAddressIPv4, 10, 0, 0, 2, 0x26, 0x04}},
+		{"ipv6 bound", append(append([]byte{socksAddressIPv6}, net.ParseIP("2001:db8::2")...), 0x26, 0x04)},
+		{"domain bound", append([]byte{socksAddressDomain, 10}, "proxy.test\x26\x04"...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer proxy.Close()
+			requested := make(chan []byte, 1)
+			reply := append([]byte{socksVersion, socksReplySucceeded, 0x00}, tt.bound...)
+			go serveSOCKS5Reply(t, proxy, reply, requested)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			conn, err := NewSOCKS5(proxy.Addr().String(), nil).DialContext(ctx, "tcp", "node.example.com:9732")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			// The host name is resolved by the proxy
+			expected := append([]byte{socksVersion, socksCommandConnect, 0x00, socksAddressDomain, 16}, "node.example.com\x26\x04"...)
+			if request := <-requested; !bytes.Equal(request, expected) {
+				t.Errorf("%x != %x", request, expected)
+			}
+
+			// The bound address is skipped, so the tunnel starts right after the reply
+			greeting := make([]byte, 5)
+			if _, err := io.ReadFull(conn, greeting); err != nil {
+				t.Fatal(err)
+			}
+			if string(greeting) != "hello" {
+				t.Errorf("%q != hello", greeting)
+			}
+		})
+	}
+}
+
+type recordingDialer struct {
+	index int
+	calls *[]int
+}
+
+func (dialer recordingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	*dialer.calls = append(*dialer.calls, dialer.index)
+	return nil, errors.New("not connected")
+}
+
+func TestRoundRobin(t *testing.T) {
+	var calls []int
+	pool := NewRoundRobin(recordingDialer{0, &calls}, recordingDialer{1, &calls}, recordingDialer{2, &calls})
+	for i := 0; i < 7; i++ {
+		pool.DialContext(context.Background(), "tcp", "127.0.0.1:9732")
+	}
+
+	want := []int{0, 1, 2, 0, 1, 2, 0}
+	if len(calls) != len(want) {
+		t.Fatalf("%d != %d", len(calls), len(want))
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d: %d != %d", i, calls[i], want[i])
+		}
+	}
+}
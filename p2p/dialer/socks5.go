@@ -0,0 +1,264 @@
+package dialer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// DefaultTorAddress - SOCKS port of a local Tor daemon.
+const DefaultTorAddress = "127.0.0.1:9050"
+
+// SOCKS5 protocol constants (RFC 1928, RFC 1929)
+const (
+	socksVersion        = 0x05
+	socksAuthNone       = 0x00
+	socksAuthPassword   = 0x02
+	socksAuthNoAccepted = 0xff
+	socksCommandConnect = 0x01
+	socksAddressIPv4    = 0x01
+	socksAddressDomain  = 0x03
+	socksAddressIPv6    = 0x04
+	socksPasswordOK     = 0x00
+	socksReplySucceeded = 0x00
+)
+
+var socksReplies = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// Auth - username and password of the SOCKS5 proxy.
+type Auth struct {
+	Username string
+	Password string
+}
+
+// SOCKS5 - dials through the SOCKS5 proxy. Host names are resolved by the proxy.
+type SOCKS5 struct {
+	address string
+	auth    *Auth
+	isolate bool
+	forward Dialer
+}
+
+// NewSOCKS5 - creates dialer of the proxy. auth may be nil if the proxy doesn't require authentication.
+func NewSOCKS5(address string, auth *Auth) *SOCKS5 {
+	return &SOCKS5{
+		address: address,
+		auth:    auth,
+		forward: Direct(),
+	}
+}
+
+// NewTor - creates dialer of the Tor SOCKS port. If address is empty DefaultTorAddress is used.
+// If isolate is set, every connection is sent with random credentials, so Tor builds a separate circuit for it
+// and remotes can't link connections by the exit node.
+func NewTor(address string, isolate bool) *SOCKS5 {
+	if address == "" {
+		address = DefaultTorAddress
+	}
+	dialer := NewSOCKS5(address, nil)
+	dialer.isolate = isolate
+	return dialer
+}
+
+// Via - sets the dialer which connects to the proxy. Default is Direct.
+func (dialer *SOCKS5) Via(forward Dialer) *SOCKS5 {
+	dialer.forward = forward
+	return dialer
+}
+
+// DialContext -
+func (dialer *SOCKS5) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("socks5: network %s is not supported", network)
+	}
+
+	conn, err := dialer.forward.DialContext(ctx, "tcp", dialer.address)
+	if err != nil {
+		return nil, fmt.Errorf("socks5: can't connect to proxy %s: %w", dialer.address, err)
+	}
+
+	if err := dialer.connect(ctx, conn, address); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("socks5: %s via %s: %w", address, dialer.address, err)
+	}
+	return conn, nil
+}
+
+// connect - negotiates the method and requests the connection. Cancellation of the context interrupts the exchange.
+func (dialer *SOCKS5) connect(ctx context.Context, conn net.Conn, address string) (err error) {
+	defer conn.SetDeadline(time.Time{})
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	defer func() {
+		// the deadline is reset after the watcher is finished, so the tunnel isn't broken by late cancellation
+		close(done)
+		<-finished
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
+
+	auth, err := dialer.credentials()
+	if err != nil {
+		return err
+	}
+	if err := negotiate(conn, auth); err != nil {
+		return err
+	}
+	return request(conn, address)
+}
+
+func (dialer *SOCKS5) credentials() (*Auth, error) {
+	if !dialer.isolate {
+		return dialer.auth, nil
+	}
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return &Auth{Username: hex.EncodeToString(random), Password: "x"}, nil
+}
+
+func negotiate(conn net.Conn, auth *Auth) error {
+	method := byte(socksAuthNone)
+	if auth != nil {
+		method = socksAuthPassword
+	}
+	if _, err := conn.Write([]byte{socksVersion, 1, method}); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion {
+		return fmt.Errorf("unexpected version %d", reply[0])
+	}
+	switch reply[1] {
+	case socksAuthNone:
+		return nil
+	case socksAuthPassword:
+		if auth == nil {
+			return errors.New("proxy requires authentication")
+		}
+		return authenticate(conn, *auth)
+	case socksAuthNoAccepted:
+		return errors.New("no acceptable authentication method")
+	default:
+		return fmt.Errorf("unexpected authentication method %d", reply[1])
+	}
+}
+
+func authenticate(conn net.Conn, auth Auth) error {
+	if len(auth.Username) == 0 || len(auth.Username) > 255 || len(auth.Password) > 255 {
+		return errors.New("invalid username or password length")
+	}
+	data := []byte{0x01, byte(len(auth.Username))}
+	data = append(data, auth.Username...)
+	data = append(data, byte(len(auth.Password)))
+	data = append(data, auth.Password...)
+	if _, err := conn.Write(data); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[1] != socksPasswordOK {
+		return errors.New("authentication failed")
+	}
+	return nil
+}
+
+func request(conn net.Conn, address string) error {
+	host, portValue, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portValue, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %s", portValue)
+	}
+
+	data := []byte{socksVersion, socksCommandConnect, 0x00}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("host name is too long: %s", host)
+		}
+		data = append(data, socksAddressDomain, byte(len(host)))
+		data = append(data, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		data = append(data, socksAddressIPv4)
+		data = append(data, ip4...)
+	} else {
+		data = append(data, socksAddressIPv6)
+		data = append(data, ip.To16()...)
+	}
+	data = append(data, byte(port>>8), byte(port))
+	if _, err := conn.Write(data); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != socksReplySucceeded {
+		if reason, ok := socksReplies[header[1]]; ok {
+			return errors.New(reason)
+		}
+		return fmt.Errorf("request failed with code %d", header[1])
+	}
+
+	// the bound address is read to leave the stream at the beginning of the tunnel
+	var size int
+	switch header[3] {
+	case socksAddressIPv4:
+		size = net.IPv4len
+	case socksAddressIPv6:
+		size = net.IPv6len
+	case socksAddressDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		size = int(length[0])
+	default:
+		return fmt.Errorf("unexpected address type %d", header[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, size+2))
+	return err
+}
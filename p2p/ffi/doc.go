@@ -0,0 +1,6 @@
+// Package ffi - bridge to libtezos.so. It requires cgo and OCaml runtime, so it is built with `ffi` tag only:
+//
+//	go build -tags ffi
+//
+// Pure-Go identity generation is available in the identity package.
+package ffi
@@ -1,3 +1,6 @@
+//go:build ffi
+// +build ffi
+
 package ffi
 
 /*
@@ -51,16 +54,24 @@ import (
 	"log"
 	"os"
 	"unsafe"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/identity"
+)
+
+const (
+	identityFile       = "identity.json"
+	identityDifficulty = 26.
 )
 
-const identityFile = "identity.json"
+// Identity -
+type Identity = identity.Identity
+
+// Provider - identity.Provider which generates identity with libtezos.so.
+type Provider struct{}
 
 // Identity -
-type Identity struct {
-	PeerID           string `json:"peer_id"`
-	PublicKey        string `json:"public_key"`
-	SecretKey        string `json:"secret_key"`
-	ProofOfWorkStamp string `json:"proof_of_work_stamp"`
+func (Provider) Identity() (Identity, error) {
+	return GetIdentity()
 }
 
 // GetIdentity -
@@ -70,13 +81,9 @@ func GetIdentity() (Identity, error) {
 		if os.IsNotExist(err) {
 			identity, err := GenerateIdentity()
 			if err != nil {
-				log.Println(err)
+				return Identity{}, err
 			}
-			log.Println("Identity Generation Successful")
-			log.Println("peerId: ", identity.PeerID)
-			log.Println("publicKey: ", identity.PublicKey)
-			log.Println("secretKey: ", identity.SecretKey)
-			log.Println("POW: ", identity.ProofOfWorkStamp)
+			log.Printf("Identity generated successfully: %s", identity.PeerID)
 			return identity, nil
 		}
 		return Identity{}, err
@@ -87,11 +94,10 @@ func GetIdentity() (Identity, error) {
 	if err != nil {
 		return Identity{}, err
 	}
-	log.Println("Identity obtained successfully")
-	log.Println("peerId: ", identity.PeerID)
-	log.Println("publicKey: ", identity.PublicKey)
-	log.Println("secretKey: ", identity.SecretKey)
-	log.Println("POW: ", identity.ProofOfWorkStamp)
+	if err := identity.Validate(identityDifficulty); err != nil {
+		return Identity{}, err
+	}
+	log.Printf("Identity obtained successfully: %s", identity.PeerID)
 	return identity, nil
 }
 
@@ -107,7 +113,7 @@ func GenerateIdentity() (Identity, error) {
 	funcName := C.CString("generate_identity")
 	defer C.free(unsafe.Pointer(funcName))
 	funcPoint := C.caml_named_value(funcName)
-	callbackFunc := C.caml_callback(*funcPoint, C.copy_double(26.))
+	callbackFunc := C.caml_callback(*funcPoint, C.copy_double(identityDifficulty))
 	returnStr := C.valueToString(callbackFunc)
 	str := C.GoString(returnStr)
 	identity := Identity{}
@@ -1,8 +1,10 @@
 module github.com/aopoltorzhicky/tezos-scanner/p2p
 
-go 1.13
+go 1.18
 
 require (
 	github.com/btcsuite/btcutil v1.0.2
 	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
 )
+
+require golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
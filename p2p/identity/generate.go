@@ -0,0 +1,43 @@
+package identity
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"runtime"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// DefaultDifficulty - proof-of-work difficulty which octez nodes generate and require by default.
+const DefaultDifficulty = 26.
+
+// Generate - creates a new key pair and searches for a proof-of-work stamp of difficulty using all cores.
+func Generate(difficulty float64) (Identity, error) {
+	return GenerateWithWorkers(difficulty, runtime.NumCPU())
+}
+
+// GenerateWithWorkers - the same as Generate but the stamp is searched by workers goroutines.
+func GenerateWithWorkers(difficulty float64, workers int) (Identity, error) {
+	publicKey, secretKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	peerID, err := crypto.CalcPeerID(publicKey[:])
+	if err != nil {
+		return Identity{}, err
+	}
+
+	stamp, err := crypto.GenerateProofOfWork(publicKey[:], difficulty, workers)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	return Identity{
+		PeerID:           peerID,
+		PublicKey:        hex.EncodeToString(publicKey[:]),
+		SecretKey:        hex.EncodeToString(secretKey[:]),
+		ProofOfWorkStamp: hex.EncodeToString(stamp),
+	}, nil
+}
@@ -0,0 +1,43 @@
+package identity
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+// Identity - keys and proof-of-work stamp of a peer. It has the same format as octez identity.json.
+type Identity struct {
+	PeerID           string `json:"peer_id"`
+	PublicKey        string `json:"public_key"`
+	SecretKey        string `json:"secret_key"`
+	ProofOfWorkStamp string `json:"proof_of_work_stamp"`
+}
+
+// String - returns peer ID only, so secret key never gets into logs.
+func (identity Identity) String() string {
+	return identity.PeerID
+}
+
+// GoString -
+func (identity Identity) GoString() string {
+	return identity.String()
+}
+
+// Load - reads identity from JSON file.
+func Load(path string) (identity Identity, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &identity)
+	return
+}
+
+// Save - writes identity to JSON file. The file is readable by its owner only because it contains the secret key.
+func (identity Identity) Save(path string) error {
+	data, err := json.Marshal(identity)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
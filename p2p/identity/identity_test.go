@@ -0,0 +1,63 @@
+package identity
+
+import (
+	"encoding/hex"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestGenerate(t *testing.T) {
+	identity, err := GenerateWithWorkers(8, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, err := hex.DecodeString(identity.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamp, err := hex.DecodeString(identity.ProofOfWorkStamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerID, _ := crypto.CalcPeerID(publicKey)
+	if identity.PeerID != peerID {
+		t.Errorf("%s != %s", identity.PeerID, peerID)
+	}
+	if !crypto.CheckProofOfWork(publicKey, stamp, 8) {
+		t.Errorf("proof of work stamp doesn't satisfy difficulty")
+	}
+
+	// octez target of integer difficulty d is 2^(250-d) - 1, the hash is a little-endian number
+	hash := blake2b.Sum256(append(publicKey, stamp...))
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	if bitLen := new(big.Int).SetBytes(hash[:]).BitLen(); bitLen > 250-8 {
+		t.Errorf("hash of %d bits exceeds octez target of difficulty 8", bitLen)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	identity, err := GenerateWithWorkers(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "identity.json")
+	if err := identity.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != identity {
+		t.Errorf("%+v != %+v", loaded, identity)
+	}
+}
@@ -0,0 +1,104 @@
+package identity
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// NodeIdentityFile - name of the identity file in octez node data directory.
+const NodeIdentityFile = "identity.json"
+
+// Provider - source of the identity which is used to connect to peers.
+type Provider interface {
+	Identity() (Identity, error)
+}
+
+// FileProvider - reads identity from the file and validates it. If the file doesn't exist a new identity is generated and saved to it.
+type FileProvider struct {
+	path       string
+	difficulty float64
+}
+
+// NewFileProvider -
+func NewFileProvider(path string, difficulty float64) *FileProvider {
+	return &FileProvider{
+		path:       path,
+		difficulty: difficulty,
+	}
+}
+
+// Identity -
+func (p *FileProvider) Identity() (Identity, error) {
+	identity, err := Load(p.path)
+	switch {
+	case err == nil:
+		return identity, identity.Validate(p.difficulty)
+	case !os.IsNotExist(err):
+		return identity, err
+	}
+
+	if identity, err = Generate(p.difficulty); err != nil {
+		return identity, err
+	}
+	return identity, identity.Save(p.path)
+}
+
+// NodeProvider - reads identity of the existing octez node from its data directory and validates it. The file is never modified.
+type NodeProvider struct {
+	dataDir    string
+	difficulty float64
+}
+
+// NewNodeProvider -
+func NewNodeProvider(dataDir string, difficulty float64) *NodeProvider {
+	return &NodeProvider{
+		dataDir:    dataDir,
+		difficulty: difficulty,
+	}
+}
+
+// Identity -
+func (p *NodeProvider) Identity() (Identity, error) {
+	identity, err := Load(filepath.Join(p.dataDir, NodeIdentityFile))
+	if err != nil {
+		return identity, err
+	}
+	return identity, identity.Validate(p.difficulty)
+}
+
+// StaticProvider - returns the identity which is kept in memory.
+type StaticProvider struct {
+	identity Identity
+}
+
+// NewStaticProvider -
+func NewStaticProvider(identity Identity) *StaticProvider {
+	return &StaticProvider{identity}
+}
+
+// Identity -
+func (p *StaticProvider) Identity() (Identity, error) {
+	return p.identity, nil
+}
+
+// EphemeralProvider - generates identity on the first call and keeps it in memory only. It is useful for tests and short runs.
+type EphemeralProvider struct {
+	difficulty float64
+	identity   Identity
+	err        error
+	once       sync.Once
+}
+
+// NewEphemeralProvider -
+func NewEphemeralProvider(difficulty float64) *EphemeralProvider {
+	return &EphemeralProvider{difficulty: difficulty}
+}
+
+// Identity -
+func (p *EphemeralProvider) Identity() (Identity, error) {
+	p.once.Do(func() {
+		p.identity, p.err = Generate(p.difficulty)
+	})
+	return p.identity, p.err
+}
@@ -0,0 +1,78 @@
+package identity
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.json")
+	provider := NewFileProvider(path, 0)
+
+	generated, err := provider.Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("identity is not saved: %s", err)
+	}
+
+	loaded, err := provider.Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != generated {
+		t.Errorf("%s != %s", loaded.PeerID, generated.PeerID)
+	}
+}
+
+func TestNodeProvider(t *testing.T) {
+	dataDir := t.TempDir()
+	provider := NewNodeProvider(dataDir, 0)
+	if _, err := provider.Identity(); err == nil {
+		t.Errorf("node provider must not generate identity")
+	}
+
+	identity, err := GenerateWithWorkers(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := identity.Save(filepath.Join(dataDir, NodeIdentityFile)); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := provider.Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != identity {
+		t.Errorf("%s != %s", loaded.PeerID, identity.PeerID)
+	}
+}
+
+func TestEphemeralProvider(t *testing.T) {
+	provider := NewEphemeralProvider(0)
+	first, err := provider.Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := provider.Identity()
+	if first != second {
+		t.Errorf("%s != %s", first.PeerID, second.PeerID)
+	}
+}
+
+func TestIdentityFormatting(t *testing.T) {
+	identity, err := GenerateWithWorkers(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		if str := fmt.Sprintf(format, identity); strings.Contains(str, identity.SecretKey) {
+			t.Errorf("%s prints secret key", format)
+		}
+	}
+}
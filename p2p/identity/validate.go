@@ -0,0 +1,74 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	keySize              = 32
+	proofOfWorkStampSize = 24
+)
+
+// Validation errors
+var (
+	ErrInvalidPublicKey        = errors.New("invalid public key")
+	ErrInvalidSecretKey        = errors.New("invalid secret key")
+	ErrKeyPairMismatch         = errors.New("secret key doesn't match public key")
+	ErrPeerIDMismatch          = errors.New("peer ID doesn't match public key")
+	ErrInvalidProofOfWorkStamp = errors.New("invalid proof of work stamp")
+	ErrInsufficientProofOfWork = errors.New("proof of work stamp doesn't satisfy difficulty")
+)
+
+// Validate - checks that keys form a valid key pair, peer ID is derived from the public key
+// and proof-of-work stamp satisfies difficulty.
+func (identity Identity) Validate(difficulty float64) error {
+	publicKey, err := decodeKey(identity.PublicKey, keySize)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPublicKey, err)
+	}
+	secretKey, err := decodeKey(identity.SecretKey, keySize)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSecretKey, err)
+	}
+
+	var scalar, derived [keySize]byte
+	copy(scalar[:], secretKey)
+	curve25519.ScalarBaseMult(&derived, &scalar)
+	if !bytes.Equal(derived[:], publicKey) {
+		return ErrKeyPairMismatch
+	}
+
+	peerID, err := crypto.CalcPeerID(publicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPublicKey, err)
+	}
+	if peerID != identity.PeerID {
+		return fmt.Errorf("%w: %s != %s", ErrPeerIDMismatch, identity.PeerID, peerID)
+	}
+
+	stamp, err := decodeKey(identity.ProofOfWorkStamp, proofOfWorkStampSize)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidProofOfWorkStamp, err)
+	}
+	if !crypto.CheckProofOfWork(publicKey, stamp, difficulty) {
+		return fmt.Errorf("%w: %f < %f", ErrInsufficientProofOfWork, crypto.ProofOfWorkDifficulty(publicKey, stamp), difficulty)
+	}
+	return nil
+}
+
+func decodeKey(str string, size int) ([]byte, error) {
+	data, err := hex.DecodeString(str)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != size {
+		return nil, fmt.Errorf("invalid length %d, expected %d", len(data), size)
+	}
+	return data, nil
+}
@@ -0,0 +1,67 @@
+package identity
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// octezWeakStamp - returns the stamp which has difficulty between 4 and 8 by octez rules:
+// its little-endian hash has 243 to 246 bits, while the target of difficulty 8 is 2^242 - 1.
+func octezWeakStamp(t *testing.T, publicKey string) string {
+	t.Helper()
+	key, _ := hex.DecodeString(publicKey)
+	stamp := make([]byte, proofOfWorkStampSize)
+	for i := 0; i < 1<<16; i++ {
+		stamp[22], stamp[23] = byte(i>>8), byte(i)
+		hash := blake2b.Sum256(append(append([]byte{}, key...), stamp...))
+		for l, r := 0, len(hash)-1; l < r; l, r = l+1, r-1 {
+			hash[l], hash[r] = hash[r], hash[l]
+		}
+		if bitLen := new(big.Int).SetBytes(hash[:]).BitLen(); bitLen > 242 && bitLen <= 246 {
+			return hex.EncodeToString(stamp)
+		}
+	}
+	t.Fatal("weak stamp is not found")
+	return ""
+}
+
+func TestValidate(t *testing.T) {
+	valid, err := GenerateWithWorkers(8, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateWithWorkers(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		modify     func(*Identity)
+		difficulty float64
+		want       error
+	}{
+		{"valid", func(*Identity) {}, 8, nil},
+		{"public key is not hex", func(i *Identity) { i.PublicKey = "zz" }, 0, ErrInvalidPublicKey},
+		{"truncated secret key", func(i *Identity) { i.SecretKey = i.SecretKey[:62] }, 0, ErrInvalidSecretKey},
+		{"foreign secret key", func(i *Identity) { i.SecretKey = other.SecretKey }, 0, ErrKeyPairMismatch},
+		{"foreign peer ID", func(i *Identity) { i.PeerID = other.PeerID }, 0, ErrPeerIDMismatch},
+		{"truncated stamp", func(i *Identity) { i.ProofOfWorkStamp = i.ProofOfWorkStamp[:46] }, 0, ErrInvalidProofOfWorkStamp},
+		{"weak stamp", func(i *Identity) { i.ProofOfWorkStamp = strings.Repeat("00", 24) }, 30, ErrInsufficientProofOfWork},
+		{"stamp below octez target", func(i *Identity) { i.ProofOfWorkStamp = octezWeakStamp(t, i.PublicKey) }, 8, ErrInsufficientProofOfWork},
+	}
+
+	for _, test := range tests {
+		identity := valid
+		test.modify(&identity)
+		err := identity.Validate(test.difficulty)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: %v != %v", test.name, err, test.want)
+		}
+	}
+}
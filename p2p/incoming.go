@@ -0,0 +1,76 @@
+package p2p
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
+)
+
+func (scanner *Scanner) listen() error {
+	pubKey, secretKey, bytePow, err := decodeIdentity(scanner.identity)
+	if err != nil {
+		return err
+	}
+
+	options := scanner.connectionOptions()
+	connMessage := protocol.NewConnectionMessage(options.ListeningPort, []protocol.Version{scanner.versions.Announce()}, pubKey, bytePow)
+	listener, err := protocol.NewListener(net.JoinHostPort("", strconv.Itoa(scanner.listenPort)), connMessage, secretKey, options.DisableMempool, options.PrivateNode)
+	if err != nil {
+		return err
+	}
+	listener.SetOptions(options)
+	listener.SetProofOfWorkCheck(scanner.powMode, scanner.powRequired)
+	listener.SetNetworkVersions(scanner.versions)
+	if scanner.dialer != nil {
+		listener.SetDialer(scanner.dialer)
+	}
+	scanner.listener = listener
+
+	scanner.incoming.Add(1)
+	go func() {
+		defer scanner.incoming.Done()
+
+		for peer := range listener.Peers() {
+			scanner.incoming.Add(1)
+			go func(peer *protocol.Peer) {
+				defer scanner.incoming.Done()
+				if err := scanner.processIncoming(peer); err != nil {
+					log.Printf("Error during process incoming peer: %s", err)
+				}
+			}(peer)
+		}
+	}()
+	return nil
+}
+
+func (scanner *Scanner) processIncoming(peer *protocol.Peer) error {
+	defer peer.Close()
+
+	peerIP := peer.Address.IP.String()
+	log.Printf("Incoming connection from %s", peerIP)
+	if _, ok := scanner.proofedPeers.Load(peerIP); ok {
+		return nil
+	}
+
+	if err := peer.UpdateSyncStateContext(scanner.ctx, scanner.syncedTime); err != nil {
+		return fmt.Errorf("[UpdateSyncState] %s", err)
+	}
+
+	neighbors, err := peer.GetPeersAddressesContext(scanner.ctx)
+	if err != nil {
+		return fmt.Errorf("[GetPeersAddresses] %s", err)
+	}
+
+	if scanner.ctx.Err() != nil {
+		return nil
+	}
+
+	scanner.proofedPeers.Store(peerIP, peer)
+	scanner.result <- peer
+	scanner.enqueue(neighbors)
+	scanner.enqueue(protocol.PeersFromPoints(peer.Session().SwapPoints()))
+	return nil
+}
@@ -0,0 +1,253 @@
+package p2p
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+// OperationSighting - the first announcement of the operation by the peer.
+type OperationSighting struct {
+	Address net.TCPAddr `json:"address"`
+	PeerID  string      `json:"peer_id"`
+	SeenAt  time.Time   `json:"seen_at"`
+	Pending bool        `json:"pending"`
+}
+
+// ObservedOperation - operation which is announced in mempools of peers. Sightings are sorted by time,
+// the first one is the peer which announced the operation first. Operation is set if it's fetched.
+type ObservedOperation struct {
+	Hash      crypto.OperationHash `json:"hash"`
+	Sightings []OperationSighting  `json:"sightings"`
+	Operation *protocol.Operation  `json:"operation,omitempty"`
+}
+
+// operationRequestTimeout - the operation is requested again if it isn't received in time.
+const operationRequestTimeout = 30 * time.Second
+
+// MempoolObserver - records mempool operations which peers announce in CurrentHead messages and optionally fetches
+// the operations by GetOperations. It's attached to sessions, for example by WithMempoolObserver option of the monitor.
+type MempoolObserver struct {
+	fetch      bool
+	operations map[crypto.OperationHash]*observedOperation
+	order      []crypto.OperationHash
+	requests   map[string]map[crypto.OperationHash]struct{}
+	mempools   map[string]protocol.Mempool
+	mutex      sync.Mutex
+}
+
+type observedOperation struct {
+	sightings     map[string]OperationSighting
+	operation     *protocol.Operation
+	recordedAt    time.Time
+	requestedAt   time.Time
+	requestedFrom string
+}
+
+// NewMempoolObserver - creates observer. If fetch is set, every new operation is requested from the peer which announced it first.
+func NewMempoolObserver(fetch bool) *MempoolObserver {
+	return &MempoolObserver{
+		fetch:      fetch,
+		operations: make(map[crypto.OperationHash]*observedOperation),
+		requests:   make(map[string]map[crypto.OperationHash]struct{}),
+		mempools:   make(map[string]protocol.Mempool),
+	}
+}
+
+// Attach - registers handlers of CurrentHead and Operation messages of the session. Messages which are received before are missed.
+// Operations which are requested from the peer and not received are requested again from other peers when the session is closed.
+func (observer *MempoolObserver) Attach(session *protocol.Session) {
+	go func() {
+		<-session.Done()
+		observer.release(session.Peer())
+	}()
+
+	protocol.HandleMessage(session, protocol.CurrentHeadTag, func(session *protocol.Session, msg protocol.CurrentHeadMsg) error {
+		if request := observer.observeMempool(session.Peer(), msg.Mempool, time.Now()); len(request) > 0 {
+			session.Post(protocol.GetOperationsMsg{Hashes: request})
+		}
+		return nil
+	})
+	protocol.HandleMessage(session, protocol.OperationTag, func(session *protocol.Session, msg protocol.OperationMsg) error {
+		observer.observeOperation(session.Peer(), msg.Operation, time.Now())
+		return nil
+	})
+}
+
+// observeMempool - records the mempool and returns hashes of operations which have to be fetched.
+func (observer *MempoolObserver) observeMempool(peer *protocol.Peer, mempool protocol.Mempool, seenAt time.Time) (request []crypto.OperationHash) {
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+
+	key := peer.Address.String()
+	observer.mempools[key] = mempool
+
+	record := func(hash crypto.OperationHash, pending bool) {
+		operation := observer.record(peer, hash, seenAt, pending)
+		if !observer.fetch || operation.operation != nil {
+			return
+		}
+		if !operation.requestedAt.IsZero() && seenAt.Sub(operation.requestedAt) < operationRequestTimeout {
+			return
+		}
+		observer.request(hash, operation, key, seenAt)
+		request = append(request, hash)
+	}
+	for _, hash := range mempool.KnownValid {
+		record(hash, false)
+	}
+	for _, hash := range mempool.Pending {
+		record(hash, true)
+	}
+	return
+}
+
+func (observer *MempoolObserver) observeOperation(peer *protocol.Peer, operation protocol.Operation, seenAt time.Time) {
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+
+	hash := operation.Hash()
+	observed := observer.record(peer, hash, seenAt, false)
+	if observed.operation == nil {
+		observed.operation = &operation
+		observer.unrequest(hash, observed)
+	}
+}
+
+// request - marks the operation as requested from the peer.
+func (observer *MempoolObserver) request(hash crypto.OperationHash, operation *observedOperation, key string, requestedAt time.Time) {
+	observer.unrequest(hash, operation)
+	operation.requestedAt = requestedAt
+	operation.requestedFrom = key
+	requests, ok := observer.requests[key]
+	if !ok {
+		requests = make(map[crypto.OperationHash]struct{})
+		observer.requests[key] = requests
+	}
+	requests[hash] = struct{}{}
+}
+
+// unrequest - clears the request of the operation, so it may be requested again.
+func (observer *MempoolObserver) unrequest(hash crypto.OperationHash, operation *observedOperation) {
+	if operation.requestedFrom == "" {
+		return
+	}
+	delete(observer.requests[operation.requestedFrom], hash)
+	operation.requestedAt = time.Time{}
+	operation.requestedFrom = ""
+}
+
+// release - clears requests which are sent to the disconnected peer and aren't answered.
+func (observer *MempoolObserver) release(peer *protocol.Peer) {
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+
+	key := peer.Address.String()
+	for hash := range observer.requests[key] {
+		if operation, ok := observer.operations[hash]; ok {
+			operation.requestedAt = time.Time{}
+			operation.requestedFrom = ""
+		}
+	}
+	delete(observer.requests, key)
+}
+
+func (observer *MempoolObserver) record(peer *protocol.Peer, hash crypto.OperationHash, seenAt time.Time, pending bool) *observedOperation {
+	operation, ok := observer.operations[hash]
+	if !ok {
+		operation = &observedOperation{
+			sightings:  make(map[string]OperationSighting),
+			recordedAt: seenAt,
+		}
+		observer.operations[hash] = operation
+		observer.order = append(observer.order, hash)
+	}
+
+	key := peer.Address.String()
+	if _, ok := operation.sightings[key]; !ok {
+		operation.sightings[key] = OperationSighting{
+			Address: peer.Address,
+			PeerID:  peer.ID,
+			SeenAt:  seenAt,
+			Pending: pending,
+		}
+	}
+	return operation
+}
+
+// Operation - returns the observed operation.
+func (observer *MempoolObserver) Operation(hash crypto.OperationHash) (ObservedOperation, bool) {
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+
+	operation, ok := observer.operations[hash]
+	if !ok {
+		return ObservedOperation{}, false
+	}
+	return operation.export(hash), true
+}
+
+// Operations - returns all observed operations sorted by the first sighting.
+func (observer *MempoolObserver) Operations() []ObservedOperation {
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+
+	result := make([]ObservedOperation, 0, len(observer.operations))
+	for hash, operation := range observer.operations {
+		result = append(result, operation.export(hash))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Sightings[0].SeenAt.Before(result[j].Sightings[0].SeenAt)
+	})
+	return result
+}
+
+// Mempools - returns the latest mempool announced by every peer by its address. Comparison of them shows mempool divergence.
+func (observer *MempoolObserver) Mempools() map[string]protocol.Mempool {
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+
+	result := make(map[string]protocol.Mempool, len(observer.mempools))
+	for address, mempool := range observer.mempools {
+		result[address] = mempool
+	}
+	return result
+}
+
+// Forget - drops operations which are first seen before the time. Operations are dropped in the order they are recorded,
+// so only the forgotten ones are visited.
+func (observer *MempoolObserver) Forget(before time.Time) {
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+
+	var i int
+	for ; i < len(observer.order); i++ {
+		hash := observer.order[i]
+		operation := observer.operations[hash]
+		if !operation.recordedAt.Before(before) {
+			break
+		}
+		observer.unrequest(hash, operation)
+		delete(observer.operations, hash)
+	}
+	observer.order = observer.order[i:]
+}
+
+func (operation *observedOperation) export(hash crypto.OperationHash) ObservedOperation {
+	result := ObservedOperation{
+		Hash:      hash,
+		Sightings: make([]OperationSighting, 0, len(operation.sightings)),
+		Operation: operation.operation,
+	}
+	for _, sighting := range operation.sightings {
+		result.Sightings = append(result.Sightings, sighting)
+	}
+	sort.Slice(result.Sightings, func(i, j int) bool {
+		return result.Sightings[i].SeenAt.Before(result.Sightings[j].SeenAt)
+	})
+	return result
+}
@@ -0,0 +1,96 @@
+package p2p
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+func TestMempoolObserver(t *testing.T) {
+	observer := NewMempoolObserver(true)
+	first := &protocol.Peer{ID: "first", Address: net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 9732}}
+	second := &protocol.Peer{ID: "second", Address: net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 9732}}
+	start := time.Unix(1700000000, 0)
+
+	operation := protocol.Operation{Branch: crypto.BlockHash{1}, Data: []byte{1, 2, 3}}
+	hash := operation.Hash()
+	other := crypto.OperationHash{2}
+
+	request := observer.observeMempool(second, protocol.Mempool{Pending: []crypto.OperationHash{hash}}, start)
+	if len(request) != 1 || request[0] != hash {
+		t.Errorf("invalid request: %v", request)
+	}
+	request = observer.observeMempool(first, protocol.Mempool{KnownValid: []crypto.OperationHash{hash, other}}, start.Add(time.Second))
+	if len(request) != 1 || request[0] != other {
+		t.Errorf("operation is requested twice: %v", request)
+	}
+	observer.observeOperation(second, operation, start.Add(2*time.Second))
+
+	observed, ok := observer.Operation(hash)
+	if !ok {
+		t.Fatal("operation is not observed")
+	}
+	if len(observed.Sightings) != 2 {
+		t.Fatalf("%d != 2", len(observed.Sightings))
+	}
+	if sighting := observed.Sightings[0]; sighting.PeerID != "second" || !sighting.Pending || !sighting.SeenAt.Equal(start) {
+		t.Errorf("invalid first sighting: %+v", sighting)
+	}
+	if observed.Operation == nil || observed.Operation.Hash() != hash {
+		t.Errorf("operation is not fetched")
+	}
+
+	if operations := observer.Operations(); len(operations) != 2 || operations[0].Hash != hash {
+		t.Errorf("invalid operations: %+v", operations)
+	}
+	if mempools := observer.Mempools(); len(mempools[first.Address.String()].KnownValid) != 2 {
+		t.Errorf("invalid mempools: %+v", mempools)
+	}
+
+	observer.Forget(start.Add(time.Second))
+	if _, ok := observer.Operation(hash); ok {
+		t.Errorf("operation is not forgotten")
+	}
+	if _, ok := observer.Operation(other); !ok {
+		t.Errorf("operation is forgotten")
+	}
+}
+
+func TestMempoolObserverRequestsAgain(t *testing.T) {
+	observer := NewMempoolObserver(true)
+	first := &protocol.Peer{ID: "first", Address: net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 9732}}
+	second := &protocol.Peer{ID: "second", Address: net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 9732}}
+	start := time.Unix(1700000000, 0)
+	hash := crypto.OperationHash{1}
+	mempool := protocol.Mempool{KnownValid: []crypto.OperationHash{hash}}
+
+	if request := observer.observeMempool(first, mempool, start); len(request) != 1 {
+		t.Fatalf("invalid request: %v", request)
+	}
+	if request := observer.observeMempool(second, mempool, start.Add(time.Second)); len(request) != 0 {
+		t.Errorf("operation is requested before the timeout: %v", request)
+	}
+
+	// The request is unanswered, so the operation is requested again after the timeout
+	requestedAt := start.Add(operationRequestTimeout)
+	if request := observer.observeMempool(second, mempool, requestedAt); len(request) != 1 || request[0] != hash {
+		t.Errorf("operation isn't requested after the timeout: %v", request)
+	}
+
+	// The peer which is asked is disconnected, so the operation is requested from another peer at once
+	observer.release(second)
+	if request := observer.observeMempool(first, mempool, requestedAt.Add(time.Second)); len(request) != 1 || request[0] != hash {
+		t.Errorf("operation isn't requested after disconnect: %v", request)
+	}
+	if _, ok := observer.requests[second.Address.String()]; ok {
+		t.Errorf("requests of the disconnected peer are kept")
+	}
+
+	observer.Forget(requestedAt)
+	if len(observer.order) != 0 || len(observer.requests[first.Address.String()]) != 0 {
+		t.Errorf("forgotten operation is kept in indexes: %v %v", observer.order, observer.requests)
+	}
+}
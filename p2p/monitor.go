@@ -0,0 +1,270 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/dialer"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/identity"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/networks"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+// HeadUpdate - current head which is pushed by the monitored peer. Polled is set if the head is the reply
+// to the periodic GetCurrentHead of the monitor, so ReceivedAt isn't the time when the peer announced the head.
+type HeadUpdate struct {
+	Address    net.TCPAddr
+	PeerID     string
+	Hash       crypto.BlockHash
+	Head       protocol.CurrentHeadMsg
+	ReceivedAt time.Time
+	Polled     bool
+}
+
+// Monitor - keeps long-lived sessions to the selected peers and streams every current head which they push.
+// Sessions are reestablished after failures until the monitor is stopped.
+type Monitor struct {
+	network  networks.Network
+	targets  []net.TCPAddr
+	identity identity.Identity
+
+	locator        *protocol.BlockLocator
+	powMode        protocol.ProofOfWorkMode
+	powRequired    float64
+	versions       protocol.NetworkVersions
+	options        protocol.Options
+	dialer         dialer.Dialer
+	pollInterval   time.Duration
+	reconnectDelay time.Duration
+	mempool        *MempoolObserver
+
+	updates  chan HeadUpdate
+	stop     chan struct{}
+	stopOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
+	closed   bool
+	sessions sync.Map
+	mutex    sync.RWMutex
+	wg       sync.WaitGroup
+}
+
+// NewMonitor - creates monitor of the peers. Peer address may omit the port, then the network's p2p port is used.
+func NewMonitor(network networks.Network, peers []string, provider identity.Provider, opts ...MonitorOption) (*Monitor, error) {
+	if err := network.Validate(); err != nil {
+		return nil, err
+	}
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("Empty peers array")
+	}
+
+	targets := make([]net.TCPAddr, 0, len(peers))
+	for _, peer := range peers {
+		address, err := resolvePeerAddress(peer, network.P2PPort)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, *address)
+	}
+
+	identity, err := provider.Identity()
+	if err != nil {
+		return nil, fmt.Errorf("Can't get identity: %s", err)
+	}
+
+	monitor := &Monitor{
+		network:  network,
+		targets:  targets,
+		identity: identity,
+		versions: network.Versions(),
+		updates:  make(chan HeadUpdate, 1024),
+		stop:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(monitor)
+	}
+	monitor.ctx, monitor.cancel = context.WithCancel(context.Background())
+
+	if monitor.pollInterval == 0 {
+		monitor.pollInterval = 5 * time.Second
+	}
+	if monitor.reconnectDelay == 0 {
+		monitor.reconnectDelay = 30 * time.Second
+	}
+	return monitor, nil
+}
+
+func resolvePeerAddress(peer string, defaultPort int) (*net.TCPAddr, error) {
+	if _, _, err := net.SplitHostPort(peer); err != nil {
+		peer = net.JoinHostPort(peer, strconv.Itoa(defaultPort))
+	}
+	address, err := net.ResolveTCPAddr("tcp", peer)
+	if err != nil {
+		return nil, fmt.Errorf("Can't resolve %s: %s", peer, err)
+	}
+	return address, nil
+}
+
+// Start - opens sessions to all peers.
+func (monitor *Monitor) Start() {
+	for _, target := range monitor.targets {
+		monitor.wg.Add(1)
+		go monitor.watch(target)
+	}
+}
+
+// Updates - returns channel of current heads. It's closed after Stop.
+func (monitor *Monitor) Updates() <-chan HeadUpdate {
+	return monitor.updates
+}
+
+// Stop - closes all sessions and waits until they are over. Repeated calls do nothing.
+func (monitor *Monitor) Stop() {
+	monitor.stopOnce.Do(monitor.stopMonitoring)
+}
+
+func (monitor *Monitor) stopMonitoring() {
+	log.Print("Stopping monitor...")
+	close(monitor.stop)
+	monitor.cancel()
+	monitor.sessions.Range(func(_, value interface{}) bool {
+		value.(*protocol.Session).Close()
+		return true
+	})
+	monitor.wg.Wait()
+
+	// handlers of closed sessions may still push updates
+	monitor.mutex.Lock()
+	monitor.closed = true
+	close(monitor.updates)
+	monitor.mutex.Unlock()
+}
+
+func (monitor *Monitor) watch(address net.TCPAddr) {
+	defer monitor.wg.Done()
+
+	for {
+		if err := monitor.session(address); err != nil {
+			log.Printf("Monitoring of %s: %s", address.String(), err)
+		}
+
+		select {
+		case <-monitor.stop:
+			return
+		case <-time.After(monitor.reconnectDelay):
+		}
+	}
+}
+
+func (monitor *Monitor) session(address net.TCPAddr) error {
+	node := NewNode(&protocol.Peer{Address: address}, monitor.reconnectDelay, 0, 0)
+	node.locator = monitor.locator
+	node.powMode = monitor.powMode
+	node.powRequired = monitor.powRequired
+	node.versions = monitor.versions
+	node.options = monitor.options
+	node.options.ChainID = monitor.network.ChainID
+	if node.options.RPCPort == 0 {
+		node.options.RPCPort = monitor.network.RPCPort
+	}
+	node.options = node.options.WithDefaults()
+	if monitor.dialer != nil {
+		node.dialer = monitor.dialer
+	}
+	defer node.close()
+
+	if err := node.connect(monitor.ctx); err != nil {
+		return fmt.Errorf("connection error: %s", err)
+	}
+	peer, err := node.handshaking(monitor.ctx, monitor.identity)
+	if err != nil {
+		return fmt.Errorf("handshaking error: %s", err)
+	}
+
+	// handlers are registered before the session is started, so the first pushed heads aren't lost
+	session := protocol.NewSession(peer)
+	session.AnswerRoutineRequests()
+
+	// the slot is taken while the poll is unanswered, the next head of the chain is considered its reply
+	poll := make(chan struct{}, 1)
+	protocol.HandleMessage(session, protocol.CurrentHeadTag, func(session *protocol.Session, msg protocol.CurrentHeadMsg) error {
+		receivedAt := time.Now()
+		var polled bool
+		if msg.ChainID == monitor.network.ChainID {
+			select {
+			case <-poll:
+				polled = true
+			default:
+			}
+		}
+		monitor.push(HeadUpdate{
+			Address:    address,
+			PeerID:     peer.ID,
+			Hash:       msg.CurrentBlockHeader.Hash(),
+			Head:       msg,
+			ReceivedAt: receivedAt,
+			Polled:     polled,
+		})
+		return nil
+	})
+	if monitor.mempool != nil {
+		monitor.mempool.Attach(session)
+	}
+	session.Start()
+
+	monitor.sessions.Store(address.String(), session)
+	defer monitor.sessions.Delete(address.String())
+	defer session.Close()
+
+	// Stop may have missed the session if it was called during handshaking
+	select {
+	case <-monitor.stop:
+		return nil
+	default:
+	}
+
+	// Periodic requests of the current head keep the connection busy when the peer has nothing to push
+	ticker := time.NewTicker(monitor.pollInterval)
+	defer ticker.Stop()
+
+	request := protocol.GetCurrentHeadMsg{ChainID: monitor.network.ChainID}
+	sendPoll := func() {
+		// the previous poll may be left unanswered
+		select {
+		case <-poll:
+		default:
+		}
+		poll <- struct{}{}
+		session.Post(request)
+	}
+	sendPoll()
+	for {
+		select {
+		case <-monitor.stop:
+			return nil
+		case <-session.Done():
+			return session.Err()
+		case <-ticker.C:
+			sendPoll()
+		}
+	}
+}
+
+func (monitor *Monitor) push(update HeadUpdate) {
+	monitor.mutex.RLock()
+	defer monitor.mutex.RUnlock()
+
+	if monitor.closed {
+		return
+	}
+	select {
+	case monitor.updates <- update:
+	case <-monitor.stop:
+	}
+}
@@ -0,0 +1,43 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/identity"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/networks"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/p2ptest"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
+)
+
+func TestMonitorPolledHead(t *testing.T) {
+	head := protocol.BlockHeader{
+		Level:     100,
+		Timestamp: time.Now().Unix(),
+	}
+	node := p2ptest.Start(t, p2ptest.Config{Head: head})
+
+	monitor, err := NewMonitor(networks.Mainnet, []string{node.Point()}, identity.NewEphemeralProvider(0), WithPollInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	monitor.Start()
+	defer monitor.Stop()
+	// the second call mustn't panic
+	defer monitor.Stop()
+
+	select {
+	case update := <-monitor.Updates():
+		if !update.Polled {
+			t.Errorf("reply to the poll is not marked as polled")
+		}
+		if hash := head.Hash(); update.Hash != hash {
+			t.Errorf("%s != %s", update.Hash, hash)
+		}
+		if update.PeerID != node.PeerID() {
+			t.Errorf("%s != %s", update.PeerID, node.PeerID())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("head is not received")
+	}
+}
@@ -0,0 +1,133 @@
+// Package networks - presets of tezos networks which are used by p2p scanners.
+package networks
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+// Network - chain parameters which differ between tezos networks.
+type Network struct {
+	Name                  string         `json:"name"`
+	ChainName             string         `json:"chain_name"`
+	ChainID               crypto.ChainID `json:"chain_id"`
+	P2PPort               int            `json:"p2p_port"`
+	RPCPort               int            `json:"rpc_port"`
+	DistributedDBVersions []uint16       `json:"distributed_db_versions"`
+	P2PVersions           []uint16       `json:"p2p_versions"`
+	Bootstrap             []string       `json:"bootstrap"`
+}
+
+// Versions - network versions which are negotiated with peers.
+func (network Network) Versions() protocol.NetworkVersions {
+	return protocol.NetworkVersions{
+		ChainName:             network.ChainName,
+		DistributedDBVersions: network.DistributedDBVersions,
+		P2PVersions:           network.P2PVersions,
+	}
+}
+
+// Validate - checks that all required fields are set.
+func (network Network) Validate() error {
+	switch {
+	case network.Name == "":
+		return fmt.Errorf("network name is empty")
+	case network.ChainName == "":
+		return fmt.Errorf("%s: chain name is empty", network.Name)
+	case network.ChainID == crypto.ChainID{}:
+		return fmt.Errorf("%s: chain ID is empty", network.Name)
+	case network.P2PPort <= 0 || network.P2PPort > 65535:
+		return fmt.Errorf("%s: invalid p2p port %d", network.Name, network.P2PPort)
+	case network.RPCPort <= 0 || network.RPCPort > 65535:
+		return fmt.Errorf("%s: invalid rpc port %d", network.Name, network.RPCPort)
+	case len(network.DistributedDBVersions) == 0 || len(network.P2PVersions) == 0:
+		return fmt.Errorf("%s: supported versions are empty", network.Name)
+	}
+	return nil
+}
+
+// Built-in networks
+var (
+	Mainnet = Network{
+		Name:                  "mainnet",
+		ChainName:             "TEZOS_MAINNET",
+		ChainID:               crypto.ChainID{0x7a, 0x06, 0xa7, 0x70}, // NetXdQprcVkpaWU
+		P2PPort:               9732,
+		RPCPort:               8732,
+		DistributedDBVersions: []uint16{0, 1, 2},
+		P2PVersions:           []uint16{0, 1},
+		Bootstrap: []string{
+			"boot.tzinit.org",
+			"boot.tzbeta.net",
+			"dubnodes.tzbeta.net",
+			"franodes.tzbeta.net",
+			"sinnodes.tzbeta.net",
+			"nrtnodes.tzbeta.net",
+			"pdxnodes.tzbeta.net",
+		},
+	}
+
+	Ghostnet = Network{
+		Name:                  "ghostnet",
+		ChainName:             "TEZOS_ITHACANET_2022-01-25T15:00:00Z",
+		ChainID:               crypto.ChainID{0xaf, 0x18, 0x64, 0xd9}, // NetXnHfVqm9iesp
+		P2PPort:               9732,
+		RPCPort:               8732,
+		DistributedDBVersions: []uint16{0, 1, 2},
+		P2PVersions:           []uint16{0, 1},
+		Bootstrap: []string{
+			"ghostnet.teztnets.com",
+			"ghostnet.tzinit.org",
+			"ghostnet.tzboot.net",
+		},
+	}
+)
+
+var (
+	registry = map[string]Network{
+		Mainnet.Name:  Mainnet,
+		Ghostnet.Name: Ghostnet,
+	}
+	mutex sync.RWMutex
+)
+
+// Register - adds custom network or replaces the one with the same name.
+func Register(network Network) error {
+	if err := network.Validate(); err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	registry[network.Name] = network
+	return nil
+}
+
+// Get - returns registered network by name.
+func Get(name string) (Network, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	network, ok := registry[name]
+	if !ok {
+		return network, fmt.Errorf("unknown network: %s", name)
+	}
+	return network, nil
+}
+
+// Names - returns names of registered networks in alphabetical order.
+func Names() []string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,63 @@
+package networks
+
+import (
+	"testing"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+func TestBuiltinNetworks(t *testing.T) {
+	for _, name := range []string{"mainnet", "ghostnet"} {
+		network, err := Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := network.Validate(); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+		if _, err := crypto.ParseChainID(network.ChainID.String()); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+
+	if Mainnet.ChainID.String() != "NetXdQprcVkpaWU" {
+		t.Errorf("%s != NetXdQprcVkpaWU", Mainnet.ChainID)
+	}
+	if Ghostnet.ChainID.String() != "NetXnHfVqm9iesp" {
+		t.Errorf("%s != NetXnHfVqm9iesp", Ghostnet.ChainID)
+	}
+	if version := Mainnet.Versions().Announce(); version.Name != "TEZOS_MAINNET" || version.Major != 2 || version.Minor != 1 {
+		t.Errorf("unexpected mainnet version %v", version)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	custom := Network{
+		Name:                  "private",
+		ChainName:             "TEZOS_PRIVATE",
+		ChainID:               crypto.ChainID{0x62, 0x52, 0xbe, 0x4f},
+		P2PPort:               19732,
+		RPCPort:               18732,
+		DistributedDBVersions: []uint16{2},
+		P2PVersions:           []uint16{1},
+	}
+	if err := Register(custom); err != nil {
+		t.Fatal(err)
+	}
+
+	network, err := Get("private")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if network.ChainID != custom.ChainID {
+		t.Errorf("%s != %s", network.ChainID, custom.ChainID)
+	}
+
+	custom.Name = ""
+	if err := Register(custom); err == nil {
+		t.Errorf("network without name must be rejected")
+	}
+	if _, err := Get("unknown"); err == nil {
+		t.Errorf("unknown network must not be found")
+	}
+}
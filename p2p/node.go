@@ -1,13 +1,15 @@
 package p2p
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"net"
 	"strconv"
 	"time"
 
-	"github.com/aopoltorzhicky/tezos-scanner/p2p/ffi"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/dialer"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/identity"
 	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
 )
 
@@ -16,6 +18,12 @@ type Node struct {
 	Peer *protocol.Peer
 
 	connection       net.Conn
+	locator          *protocol.BlockLocator
+	options          protocol.Options
+	dialer           dialer.Dialer
+	versions         protocol.NetworkVersions
+	powMode          protocol.ProofOfWorkMode
+	powRequired      float64
 	attemptsDuration time.Duration
 	nextRetryTime    time.Time
 	syncedTime       int64
@@ -27,6 +35,9 @@ type Node struct {
 func NewNode(peer *protocol.Peer, attemptsDuration time.Duration, maxAttemptsCount, syncedTime int64) *Node {
 	return &Node{
 		Peer:             peer,
+		versions:         protocol.DefaultNetworkVersions(),
+		options:          protocol.DefaultOptions(),
+		dialer:           dialer.Direct(),
 		attemptsDuration: attemptsDuration,
 		nextRetryTime:    time.Now(),
 		maxAttemptsCount: maxAttemptsCount,
@@ -40,24 +51,24 @@ func (node *Node) close() {
 	}
 }
 
-func (node *Node) getPeer(identity ffi.Identity) (*protocol.Peer, error) {
-	if err := node.connect(); err != nil {
+func (node *Node) getPeer(ctx context.Context, identity identity.Identity) (*protocol.Peer, error) {
+	if err := node.connect(ctx); err != nil {
 		return nil, fmt.Errorf("connection error: %s", err)
 	}
 
-	peer, err := node.handshaking(identity)
+	peer, err := node.handshaking(ctx, identity)
 	if err != nil {
-		return peer, fmt.Errorf("handshaking error: %s", err)
+		return peer, fmt.Errorf("handshaking error: %w", err)
 	}
 
-	err = peer.UpdateSyncState(node.syncedTime)
+	err = peer.UpdateSyncStateContext(ctx, node.syncedTime)
 	if err != nil {
 		err = fmt.Errorf("UpdateSyncState error: %s", err)
 	}
 	return peer, err
 }
 
-func (node *Node) connect() error {
+func (node *Node) connect(ctx context.Context) error {
 	if time.Now().Before(node.nextRetryTime) {
 		return fmt.Errorf("%s is waiting until %v", node.Peer.Address.IP.String(), node.nextRetryTime)
 	}
@@ -68,10 +79,12 @@ func (node *Node) connect() error {
 	}
 	port := strconv.Itoa(node.Peer.Address.Port)
 
-	connection, err := net.DialTimeout(
+	ctx, cancel := context.WithTimeout(ctx, node.options.DialTimeout)
+	defer cancel()
+	connection, err := node.dialer.DialContext(
+		ctx,
 		tcpType,
 		net.JoinHostPort(node.Peer.Address.IP.String(), port),
-		time.Second*8,
 	)
 	if err != nil {
 		node.nextRetryTime = time.Now().Add(node.attemptsDuration)
@@ -83,49 +96,49 @@ func (node *Node) connect() error {
 	return nil
 }
 
-func (node *Node) handshaking(identity ffi.Identity) (*protocol.Peer, error) {
-	secretKey, err := hex.DecodeString(identity.SecretKey)
+func decodeIdentity(identity identity.Identity) (pubKey, secretKey, bytePow []byte, err error) {
+	secretKey, err = hex.DecodeString(identity.SecretKey)
 	if err != nil {
-		return nil, err
+		return
 	}
-	pubKey, err := hex.DecodeString(identity.PublicKey)
+	pubKey, err = hex.DecodeString(identity.PublicKey)
 	if err != nil {
-		return nil, err
+		return
 	}
-	bytePow, err := hex.DecodeString(identity.ProofOfWorkStamp)
+	bytePow, err = hex.DecodeString(identity.ProofOfWorkStamp)
+	return
+}
+
+func (node *Node) handshaking(ctx context.Context, identity identity.Identity) (*protocol.Peer, error) {
+	pubKey, secretKey, bytePow, err := decodeIdentity(identity)
 	if err != nil {
 		return nil, err
 	}
 
-	port := uint16(node.Peer.Address.Port)
-	connMessage := protocol.NewConnectionMessage(port, node.getVersions(), pubKey, bytePow)
+	port := node.options.ListeningPort
+	if port == 0 {
+		port = uint16(node.Peer.Address.Port)
+	}
+	connMessage := protocol.NewConnectionMessage(port, []protocol.Version{node.versions.Announce()}, pubKey, bytePow)
 
 	peer := protocol.NewPeer(node.connection, node.Peer.Address)
-	if err := peer.Init(connMessage, secretKey); err != nil {
+	peer.SetBlockLocator(node.locator)
+	peer.SetProofOfWorkCheck(node.powMode, node.powRequired)
+	peer.SetNetworkVersions(node.versions)
+	peer.SetOptions(node.options)
+	peer.SetDialer(node.dialer)
+	if err := peer.InitContext(ctx, connMessage, secretKey); err != nil {
 		node.incrementAttemptsWithPeer(peer)
 		return nil, err
 	}
 
-	if err = peer.Connect(false, false); err != nil {
+	if err = peer.ConnectContext(ctx, node.options.DisableMempool, node.options.PrivateNode); err != nil {
 		node.incrementAttemptsWithPeer(peer)
 		return nil, err
 	}
 	return peer, nil
 }
 
-func (node *Node) getVersions() []protocol.Version {
-	if node.Peer.Versions != nil {
-		return node.Peer.Versions
-	}
-	return []protocol.Version{
-		{
-			Name:  "TEZOS_MAINNET",
-			Major: 0,
-			Minor: 0,
-		},
-	}
-}
-
 func (node *Node) hasAttempts() bool {
 	return node.maxAttemptsCount == 0 || node.maxAttemptsCount > node.attemptsCount
 }
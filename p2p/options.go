@@ -1,6 +1,11 @@
 package p2p
 
-import "time"
+import (
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/dialer"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
+)
 
 // ScannerOption -
 type ScannerOption func(*Scanner)
@@ -32,3 +37,136 @@ func WithSyncedTime(syncedTime int64) ScannerOption {
 		scanner.syncedTime = syncedTime
 	}
 }
+
+// WithBlockLocator - sets the branch which is sent to peers in reply to GetCurrentBranch.
+// By default every peer receives a branch built from its own current head.
+func WithBlockLocator(locator protocol.BlockLocator) ScannerOption {
+	return func(scanner *Scanner) {
+		scanner.locator = &locator
+	}
+}
+
+// WithListener - accepts incoming connections on port. Peers which dial the scanner are processed as scanned candidates.
+func WithListener(port int) ScannerOption {
+	return func(scanner *Scanner) {
+		scanner.listenPort = port
+	}
+}
+
+// WithProofOfWorkCheck - sets how proof-of-work stamps of scanned peers are verified.
+// The achieved difficulty is recorded to the peer in ProofOfWorkRecord and ProofOfWorkEnforce modes.
+func WithProofOfWorkCheck(mode protocol.ProofOfWorkMode, difficulty float64) ScannerOption {
+	return func(scanner *Scanner) {
+		scanner.powMode = mode
+		scanner.powRequired = difficulty
+	}
+}
+
+// WithNetworkVersions - sets chain name and versions which are negotiated with peers. Default is protocol.DefaultNetworkVersions.
+func WithNetworkVersions(versions protocol.NetworkVersions) ScannerOption {
+	return func(scanner *Scanner) {
+		scanner.versions = versions
+	}
+}
+
+// WithConnectionOptions - sets timeouts of connection phases and parameters which are announced to peers.
+// Zero timeouts are replaced by defaults, zero listening port is replaced by the port of WithListener.
+func WithConnectionOptions(options protocol.Options) ScannerOption {
+	return func(scanner *Scanner) {
+		scanner.options = options
+	}
+}
+
+// WithTimeouts - sets timeouts of dialing, connection message exchange and reading and writing of encrypted messages.
+// Zero keeps the default value. Slow links need longer timeouts.
+func WithTimeouts(dial, handshake, read, write time.Duration) ScannerOption {
+	return func(scanner *Scanner) {
+		scanner.options.DialTimeout = dial
+		scanner.options.HandshakeTimeout = handshake
+		scanner.options.ReadTimeout = read
+		scanner.options.WriteTimeout = write
+	}
+}
+
+// WithAdvertisedPort - sets the listening port which is announced to peers. By default it's the port of WithListener.
+func WithAdvertisedPort(port uint16) ScannerOption {
+	return func(scanner *Scanner) {
+		scanner.options.ListeningPort = port
+	}
+}
+
+// WithPrivateNode - announces the scanner as a private node, so peers don't advertise it to the network.
+func WithPrivateNode(private bool) ScannerOption {
+	return func(scanner *Scanner) {
+		scanner.options.PrivateNode = private
+	}
+}
+
+// WithDisableMempool - asks peers not to send mempool operations.
+func WithDisableMempool(disable bool) ScannerOption {
+	return func(scanner *Scanner) {
+		scanner.options.DisableMempool = disable
+	}
+}
+
+// WithDialer - sets how connections to peers are established, for example through SOCKS5 proxy or Tor
+// (see the dialer package). Peers receive the dialer too, so their RPC probes leave the same way. Default is direct dial.
+func WithDialer(dialer dialer.Dialer) ScannerOption {
+	return func(scanner *Scanner) {
+		scanner.dialer = dialer
+	}
+}
+
+// MonitorOption -
+type MonitorOption func(*Monitor)
+
+// WithPollInterval - sets how often monitored peers are asked for the current head. Default is 5 seconds.
+func WithPollInterval(interval time.Duration) MonitorOption {
+	return func(monitor *Monitor) {
+		monitor.pollInterval = interval
+	}
+}
+
+// WithReconnectDelay - sets the pause before the failed session is reestablished. Default is 30 seconds.
+func WithReconnectDelay(delay time.Duration) MonitorOption {
+	return func(monitor *Monitor) {
+		monitor.reconnectDelay = delay
+	}
+}
+
+// WithMonitorBlockLocator - sets the branch which is sent to monitored peers in reply to GetCurrentBranch.
+func WithMonitorBlockLocator(locator protocol.BlockLocator) MonitorOption {
+	return func(monitor *Monitor) {
+		monitor.locator = &locator
+	}
+}
+
+// WithMonitorProofOfWorkCheck - sets how proof-of-work stamps of monitored peers are verified.
+func WithMonitorProofOfWorkCheck(mode protocol.ProofOfWorkMode, difficulty float64) MonitorOption {
+	return func(monitor *Monitor) {
+		monitor.powMode = mode
+		monitor.powRequired = difficulty
+	}
+}
+
+// WithMempoolObserver - attaches the observer to every monitored session.
+func WithMempoolObserver(observer *MempoolObserver) MonitorOption {
+	return func(monitor *Monitor) {
+		monitor.mempool = observer
+	}
+}
+
+// WithMonitorConnectionOptions - sets timeouts of connection phases and parameters which are announced to monitored peers.
+// Zero timeouts are replaced by defaults.
+func WithMonitorConnectionOptions(options protocol.Options) MonitorOption {
+	return func(monitor *Monitor) {
+		monitor.options = options
+	}
+}
+
+// WithMonitorDialer - sets how connections to monitored peers are established. Default is direct dial.
+func WithMonitorDialer(dialer dialer.Dialer) MonitorOption {
+	return func(monitor *Monitor) {
+		monitor.dialer = dialer
+	}
+}
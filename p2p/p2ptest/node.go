@@ -0,0 +1,373 @@
+// Package p2ptest - fake tezos nodes on loopback for offline tests of scanners and protocol code.
+package p2ptest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/identity"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/networks"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+// Behavior - how the fake node treats incoming connections.
+type Behavior int
+
+// Behaviors
+const (
+	// Honest - completes the handshake and answers requests.
+	Honest Behavior = iota
+	// Nack - rejects the connection with NackMotive and proposes Neighbors instead of itself.
+	Nack
+	// Truncated - sends a part of the connection message and closes the connection.
+	Truncated
+	// Garbage - sends random bytes instead of the connection message and keeps the connection open.
+	Garbage
+	// Silent - accepts the connection and never sends anything.
+	Silent
+)
+
+// String -
+func (behavior Behavior) String() string {
+	switch behavior {
+	case Honest:
+		return "honest"
+	case Nack:
+		return "nack"
+	case Truncated:
+		return "truncated"
+	case Garbage:
+		return "garbage"
+	case Silent:
+		return "silent"
+	default:
+		return fmt.Sprintf("unknown behavior %d", int(behavior))
+	}
+}
+
+// Config - parameters of the fake node. Zero values are replaced by defaults.
+type Config struct {
+	// Address - listening address. Default is 127.0.0.1 on a random port.
+	Address string
+	// Identity - keys of the node. Default is a new identity of zero difficulty.
+	Identity *identity.Identity
+	// Network - chain ID and versions of the node. Default is networks.Mainnet.
+	Network *networks.Network
+	// Versions - versions which are announced and accepted. Default is the versions of Network.
+	Versions *protocol.NetworkVersions
+
+	// Head - header which is sent in CurrentHead and CurrentBranch.
+	Head protocol.BlockHeader
+	// Mempool - operations which are sent in CurrentHead.
+	Mempool protocol.Mempool
+	// Neighbors - points which are advertised in reply to Bootstrap and proposed in nack.
+	Neighbors []string
+
+	// PrivateNode and DisableMempool are sent in metadata.
+	PrivateNode    bool
+	DisableMempool bool
+
+	// Behavior - default is Honest.
+	Behavior Behavior
+	// NackMotive - the reason of rejection in Nack behavior.
+	NackMotive protocol.NackMotive
+	// Delay - pause before the handshake and before every reply. It imitates a slow node.
+	Delay time.Duration
+}
+
+// Node - fake tezos node which accepts connections on loopback.
+type Node struct {
+	config    Config
+	identity  identity.Identity
+	network   networks.Network
+	versions  protocol.NetworkVersions
+	secretKey []byte
+	listener  net.Listener
+
+	mutex       sync.Mutex
+	connections map[net.Conn]struct{}
+	accepted    int
+	closed      bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewNode - starts the fake node. It has to be closed by Close.
+func NewNode(config Config) (*Node, error) {
+	node := &Node{
+		config:      config,
+		network:     networks.Mainnet,
+		connections: make(map[net.Conn]struct{}),
+	}
+	if config.Network != nil {
+		node.network = *config.Network
+	}
+	node.versions = node.network.Versions()
+	if config.Versions != nil {
+		node.versions = *config.Versions
+	}
+
+	if config.Identity != nil {
+		node.identity = *config.Identity
+	} else {
+		generated, err := identity.Generate(0)
+		if err != nil {
+			return nil, fmt.Errorf("Can't generate identity: %s", err)
+		}
+		node.identity = generated
+	}
+	secretKey, err := hex.DecodeString(node.identity.SecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %s", err)
+	}
+	node.secretKey = secretKey
+
+	address := config.Address
+	if address == "" {
+		address = "127.0.0.1:0"
+	}
+	if node.listener, err = net.Listen("tcp", address); err != nil {
+		return nil, err
+	}
+	node.ctx, node.cancel = context.WithCancel(context.Background())
+
+	node.wg.Add(1)
+	go node.accept()
+	return node, nil
+}
+
+// Start - starts the fake node which is closed when the test is finished. The test fails if the node can't be started.
+func Start(tb testing.TB, config Config) *Node {
+	tb.Helper()
+
+	node, err := NewNode(config)
+	if err != nil {
+		tb.Fatalf("fake node is not started: %s", err)
+	}
+	tb.Cleanup(func() {
+		node.Close()
+	})
+	return node
+}
+
+// Addr - listening address of the node.
+func (node *Node) Addr() *net.TCPAddr {
+	return node.listener.Addr().(*net.TCPAddr)
+}
+
+// Point - listening address in "host:port" form which is used in advertisements.
+func (node *Node) Point() string {
+	return node.Addr().String()
+}
+
+// PeerID -
+func (node *Node) PeerID() string {
+	return node.identity.PeerID
+}
+
+// Accepted - returns the number of accepted connections.
+func (node *Node) Accepted() int {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+	return node.accepted
+}
+
+// Close - stops accepting connections and closes established ones.
+func (node *Node) Close() error {
+	node.mutex.Lock()
+	if node.closed {
+		node.mutex.Unlock()
+		return nil
+	}
+	node.closed = true
+	for conn := range node.connections {
+		conn.Close()
+	}
+	node.mutex.Unlock()
+
+	node.cancel()
+	err := node.listener.Close()
+	node.wg.Wait()
+	return err
+}
+
+func (node *Node) accept() {
+	defer node.wg.Done()
+
+	for {
+		conn, err := node.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		node.mutex.Lock()
+		if node.closed {
+			node.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		node.connections[conn] = struct{}{}
+		node.accepted++
+		node.mutex.Unlock()
+
+		node.wg.Add(1)
+		go func() {
+			defer node.wg.Done()
+			defer node.forget(conn)
+			node.serve(conn)
+		}()
+	}
+}
+
+func (node *Node) forget(conn net.Conn) {
+	conn.Close()
+	node.mutex.Lock()
+	delete(node.connections, conn)
+	node.mutex.Unlock()
+}
+
+// pause - waits Delay. Returns false if the node is closed meanwhile.
+func (node *Node) pause() bool {
+	if node.config.Delay == 0 {
+		return true
+	}
+	select {
+	case <-time.After(node.config.Delay):
+		return true
+	case <-node.ctx.Done():
+		return false
+	}
+}
+
+func (node *Node) serve(conn net.Conn) {
+	if !node.pause() {
+		return
+	}
+
+	switch node.config.Behavior {
+	case Truncated:
+		node.sendTruncated(conn)
+	case Garbage:
+		node.sendGarbage(conn)
+	case Silent:
+		io.Copy(io.Discard, conn)
+	default:
+		if err := node.handshake(conn); err != nil {
+			return
+		}
+	}
+}
+
+// sendTruncated - announces the chunk of the connection message size but sends its beginning only.
+func (node *Node) sendTruncated(conn net.Conn) {
+	header := make([]byte, 2)
+	binary.BigEndian.PutUint16(header, 100)
+	conn.Write(append(header, make([]byte, 10)...))
+}
+
+func (node *Node) sendGarbage(conn net.Conn) {
+	garbage := make([]byte, 102)
+	rand.Read(garbage)
+	binary.BigEndian.PutUint16(garbage, uint16(len(garbage)-2))
+	if _, err := conn.Write(garbage); err != nil {
+		return
+	}
+	io.Copy(io.Discard, conn)
+}
+
+func (node *Node) handshake(conn net.Conn) error {
+	pubKey, err := hex.DecodeString(node.identity.PublicKey)
+	if err != nil {
+		return err
+	}
+	stamp, err := hex.DecodeString(node.identity.ProofOfWorkStamp)
+	if err != nil {
+		return err
+	}
+
+	address, _ := conn.RemoteAddr().(*net.TCPAddr)
+	if address == nil {
+		address = &net.TCPAddr{}
+	}
+	peer := protocol.NewPeer(conn, *address)
+	peer.SetNetworkVersions(node.versions)
+
+	connMessage := protocol.NewConnectionMessage(uint16(node.Addr().Port), []protocol.Version{node.versions.Announce()}, pubKey, stamp)
+	if err := peer.InitIncomingContext(node.ctx, connMessage, node.secretKey); err != nil {
+		return err
+	}
+
+	if node.config.Behavior == Nack {
+		return peer.RejectIncomingContext(node.ctx, node.config.NackMotive, node.config.Neighbors)
+	}
+	if err := peer.ConnectIncomingContext(node.ctx, node.config.DisableMempool, node.config.PrivateNode); err != nil {
+		return err
+	}
+	return node.answer(peer)
+}
+
+// answer - introduces the chain by GetCurrentBranch as octez nodes do and answers requests until the session is over.
+func (node *Node) answer(peer *protocol.Peer) error {
+	chainID := node.network.ChainID
+	head := protocol.CurrentHeadMsg{
+		ChainID:            chainID,
+		CurrentBlockHeader: node.config.Head,
+		Mempool:            node.config.Mempool,
+	}
+
+	session := protocol.NewSession(peer)
+	protocol.HandleMessage(session, protocol.GetCurrentBranchTag, func(session *protocol.Session, msg protocol.GetCurrentBranchMsg) error {
+		if msg.ChainID != chainID || !node.pause() {
+			return nil
+		}
+		session.Post(protocol.CurrentBranchMsg{
+			ChainID: chainID,
+			Locator: protocol.BlockLocator{
+				CurrentHead: node.config.Head,
+				History:     []crypto.BlockHash{node.config.Head.Predecessor},
+			},
+		})
+		return nil
+	})
+	protocol.HandleMessage(session, protocol.GetCurrentHeadTag, func(session *protocol.Session, msg protocol.GetCurrentHeadMsg) error {
+		if msg.ChainID != chainID || !node.pause() {
+			return nil
+		}
+		session.Post(head)
+		return nil
+	})
+	session.Handle(protocol.BootstrapTag, func(session *protocol.Session, _ interface{}) error {
+		if !node.pause() {
+			return nil
+		}
+		session.Post(protocol.AdvertiseMsg{Addresses: node.config.Neighbors})
+		return nil
+	})
+	session.Handle(protocol.DisconnectTag, func(session *protocol.Session, _ interface{}) error {
+		return protocol.ErrDisconnected
+	})
+	session.Start()
+	session.Post(protocol.GetCurrentBranchMsg{ChainID: chainID})
+
+	select {
+	case <-session.Done():
+	case <-node.ctx.Done():
+		session.Close()
+	}
+	if err := session.Err(); !errors.Is(err, protocol.ErrSessionClosed) {
+		return err
+	}
+	return nil
+}
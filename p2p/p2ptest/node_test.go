@@ -0,0 +1,137 @@
+package p2ptest
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/identity"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/networks"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
+)
+
+// connect - performs the initiator side of the handshake with the node.
+func connect(t *testing.T, ctx context.Context, node *Node) (*protocol.Peer, error) {
+	t.Helper()
+
+	local, err := identity.Generate(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, _ := hex.DecodeString(local.PublicKey)
+	secretKey, _ := hex.DecodeString(local.SecretKey)
+	stamp, _ := hex.DecodeString(local.ProofOfWorkStamp)
+
+	conn, err := net.Dial("tcp", node.Point())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	versions := networks.Mainnet.Versions()
+	peer := protocol.NewPeer(conn, *node.Addr())
+	peer.SetNetworkVersions(versions)
+	connMessage := protocol.NewConnectionMessage(0, []protocol.Version{versions.Announce()}, pubKey, stamp)
+	if err := peer.InitContext(ctx, connMessage, secretKey); err != nil {
+		return nil, err
+	}
+	return peer, peer.ConnectContext(ctx, false, false)
+}
+
+func TestHonestNode(t *testing.T) {
+	head := protocol.BlockHeader{
+		Level:     42,
+		Timestamp: time.Now().Unix(),
+	}
+	node := Start(t, Config{
+		Head:        head,
+		Neighbors:   []string{"127.0.0.1:19732", "127.0.0.2:19733"},
+		PrivateNode: true,
+	})
+
+	peer, err := connect(t, context.Background(), node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peer.ID != node.PeerID() {
+		t.Errorf("%s != %s", peer.ID, node.PeerID())
+	}
+	if !peer.PrivateNode {
+		t.Errorf("private node flag is not received")
+	}
+
+	if err := peer.UpdateSyncState(120); err != nil {
+		t.Fatal(err)
+	}
+	if hash := head.Hash(); peer.Head == nil || *peer.Head != hash {
+		t.Errorf("%v != %s", peer.Head, hash)
+	}
+	if peer.Level != head.Level {
+		t.Errorf("%d != %d", peer.Level, head.Level)
+	}
+	if !peer.Synced {
+		t.Errorf("peer is not synced")
+	}
+
+	neighbors, err := peer.GetPeersAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(neighbors) != 2 {
+		t.Fatalf("%d != 2", len(neighbors))
+	}
+	if neighbors[1].Address.String() != "127.0.0.2:19733" {
+		t.Errorf("%s != 127.0.0.2:19733", neighbors[1].Address.String())
+	}
+	if node.Accepted() != 1 {
+		t.Errorf("%d != 1", node.Accepted())
+	}
+}
+
+func TestNackNode(t *testing.T) {
+	node := Start(t, Config{
+		Behavior:   Nack,
+		NackMotive: protocol.NackTooManyConnections,
+		Neighbors:  []string{"127.0.0.1:19732"},
+	})
+
+	_, err := connect(t, context.Background(), node)
+	var nack *protocol.NackError
+	if !errors.As(err, &nack) {
+		t.Fatalf("nack is not received: %v", err)
+	}
+	if nack.Motive != protocol.NackTooManyConnections {
+		t.Errorf("%s != %s", nack.Motive, protocol.NackTooManyConnections)
+	}
+	if len(nack.Points) != 1 || nack.Points[0] != "127.0.0.1:19732" {
+		t.Errorf("unexpected points: %v", nack.Points)
+	}
+}
+
+func TestMisbehavingNode(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{name: "truncated", config: Config{Behavior: Truncated}},
+		{name: "garbage", config: Config{Behavior: Garbage}},
+		{name: "silent", config: Config{Behavior: Silent}},
+		{name: "slow", config: Config{Delay: time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := Start(t, tt.config)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			if _, err := connect(t, ctx, node); err == nil {
+				t.Errorf("%s node is connected", tt.config.Behavior)
+			}
+		})
+	}
+}
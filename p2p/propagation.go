@@ -0,0 +1,188 @@
+package p2p
+
+import (
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+// Announcement - the first announcement of the block by the peer.
+type Announcement struct {
+	Address net.TCPAddr   `json:"address"`
+	PeerID  string        `json:"peer_id"`
+	SeenAt  time.Time     `json:"seen_at"`
+	Delay   time.Duration `json:"delay"`
+}
+
+// BlockPropagation - propagation statistics of the block. Delays are counted from the first announcement by any peer.
+// Median and P90 are nearest-rank percentiles of delays. Stragglers are peers which are slower than P90, the slowest first.
+type BlockPropagation struct {
+	Hash          crypto.BlockHash `json:"hash"`
+	Level         uint32           `json:"level"`
+	FirstSeen     time.Time        `json:"first_seen"`
+	Median        time.Duration    `json:"median"`
+	P90           time.Duration    `json:"p90"`
+	Announcements []Announcement   `json:"announcements"`
+	Stragglers    []Announcement   `json:"stragglers"`
+}
+
+// PropagationTracker - records the first time each peer announces a block via CurrentHead.
+// Polled heads are skipped, as their time depends on the poll interval. Only the latest maxBlocks blocks by level are kept.
+type PropagationTracker struct {
+	maxBlocks int
+	blocks    map[crypto.BlockHash]*trackedBlock
+	mutex     sync.Mutex
+}
+
+type trackedBlock struct {
+	level uint32
+	seen  map[string]Announcement
+}
+
+// NewPropagationTracker - creates tracker. If maxBlocks is 0 every block is kept.
+func NewPropagationTracker(maxBlocks int) *PropagationTracker {
+	return &PropagationTracker{
+		maxBlocks: maxBlocks,
+		blocks:    make(map[crypto.BlockHash]*trackedBlock),
+	}
+}
+
+// Record - records the head update. Returns true if it's the first announcement of the block by the peer.
+// Blocks which are older than the kept ones are skipped.
+func (tracker *PropagationTracker) Record(update HeadUpdate) bool {
+	if update.Polled {
+		return false
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	block, ok := tracker.blocks[update.Hash]
+	if !ok {
+		level := update.Head.CurrentBlockHeader.Level
+		if !tracker.prune(level) {
+			return false
+		}
+		block = &trackedBlock{
+			level: level,
+			seen:  make(map[string]Announcement),
+		}
+		tracker.blocks[update.Hash] = block
+	}
+
+	key := update.Address.String()
+	if _, ok := block.seen[key]; ok {
+		return false
+	}
+	block.seen[key] = Announcement{
+		Address: update.Address,
+		PeerID:  update.PeerID,
+		SeenAt:  update.ReceivedAt,
+	}
+	return true
+}
+
+// Track - records all updates of the channel until it's closed.
+func (tracker *PropagationTracker) Track(updates <-chan HeadUpdate) {
+	for update := range updates {
+		tracker.Record(update)
+	}
+}
+
+// Block - returns statistics of the block.
+func (tracker *PropagationTracker) Block(hash crypto.BlockHash) (BlockPropagation, bool) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	block, ok := tracker.blocks[hash]
+	if !ok {
+		return BlockPropagation{}, false
+	}
+	return block.stats(hash), true
+}
+
+// Blocks - returns statistics of all tracked blocks sorted by level and first seen time.
+func (tracker *PropagationTracker) Blocks() []BlockPropagation {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	result := make([]BlockPropagation, 0, len(tracker.blocks))
+	for hash, block := range tracker.blocks {
+		result = append(result, block.stats(hash))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Level != result[j].Level {
+			return result[i].Level < result[j].Level
+		}
+		return result[i].FirstSeen.Before(result[j].FirstSeen)
+	})
+	return result
+}
+
+// prune - drops blocks which leave the latest maxBlocks levels when the block of the level is added.
+// Returns false if the added block itself is outside of them.
+func (tracker *PropagationTracker) prune(level uint32) bool {
+	if tracker.maxBlocks == 0 || len(tracker.blocks) < tracker.maxBlocks {
+		return true
+	}
+	levels := make([]uint32, 0, len(tracker.blocks)+1)
+	levels = append(levels, level)
+	for _, block := range tracker.blocks {
+		levels = append(levels, block.level)
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i] > levels[j] })
+	minLevel := levels[tracker.maxBlocks-1]
+	if level < minLevel {
+		return false
+	}
+	for hash, block := range tracker.blocks {
+		if block.level < minLevel {
+			delete(tracker.blocks, hash)
+		}
+	}
+	return true
+}
+
+func (block *trackedBlock) stats(hash crypto.BlockHash) BlockPropagation {
+	stats := BlockPropagation{
+		Hash:          hash,
+		Level:         block.level,
+		Announcements: make([]Announcement, 0, len(block.seen)),
+	}
+	for _, announcement := range block.seen {
+		if stats.FirstSeen.IsZero() || announcement.SeenAt.Before(stats.FirstSeen) {
+			stats.FirstSeen = announcement.SeenAt
+		}
+		stats.Announcements = append(stats.Announcements, announcement)
+	}
+	if len(stats.Announcements) == 0 {
+		return stats
+	}
+
+	for i := range stats.Announcements {
+		stats.Announcements[i].Delay = stats.Announcements[i].SeenAt.Sub(stats.FirstSeen)
+	}
+	sort.Slice(stats.Announcements, func(i, j int) bool {
+		return stats.Announcements[i].Delay < stats.Announcements[j].Delay
+	})
+
+	stats.Median = percentile(stats.Announcements, 0.5)
+	stats.P90 = percentile(stats.Announcements, 0.9)
+	for i := len(stats.Announcements) - 1; i >= 0 && stats.Announcements[i].Delay > stats.P90; i-- {
+		stats.Stragglers = append(stats.Stragglers, stats.Announcements[i])
+	}
+	return stats
+}
+
+// percentile - nearest-rank percentile of announcements sorted by delay.
+func percentile(announcements []Announcement, p float64) time.Duration {
+	rank := int(math.Ceil(p * float64(len(announcements))))
+	if rank < 1 {
+		rank = 1
+	}
+	return announcements[rank-1].Delay
+}
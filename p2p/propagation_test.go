@@ -0,0 +1,94 @@
+package p2p
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+func testHeadUpdate(hash byte, level uint32, ip byte, receivedAt time.Time) HeadUpdate {
+	var update HeadUpdate
+	update.Hash = crypto.BlockHash{hash}
+	update.Head = protocol.CurrentHeadMsg{CurrentBlockHeader: protocol.BlockHeader{Level: level}}
+	update.Address = net.TCPAddr{IP: net.IPv4(10, 0, 0, ip), Port: 9732}
+	update.ReceivedAt = receivedAt
+	return update
+}
+
+func TestPropagationTracker(t *testing.T) {
+	tracker := NewPropagationTracker(0)
+	start := time.Unix(1700000000, 0)
+
+	polled := testHeadUpdate(1, 100, 0, start.Add(-time.Minute))
+	polled.Polled = true
+	if tracker.Record(polled) {
+		t.Errorf("polled head is recorded")
+	}
+
+	for i := 0; i < 10; i++ {
+		if !tracker.Record(testHeadUpdate(1, 100, byte(i), start.Add(time.Duration(i*i)*100*time.Millisecond))) {
+			t.Errorf("announcement %d is not the first one", i)
+		}
+	}
+	if tracker.Record(testHeadUpdate(1, 100, 0, start.Add(time.Hour))) {
+		t.Errorf("repeated announcement is recorded")
+	}
+
+	stats, ok := tracker.Block(crypto.BlockHash{1})
+	if !ok {
+		t.Fatal("block is not tracked")
+	}
+	if !stats.FirstSeen.Equal(start) {
+		t.Errorf("%s != %s", stats.FirstSeen, start)
+	}
+	if len(stats.Announcements) != 10 {
+		t.Errorf("%d != 10", len(stats.Announcements))
+	}
+	if expected := 1600 * time.Millisecond; stats.Median != expected {
+		t.Errorf("%s != %s", stats.Median, expected)
+	}
+	if expected := 6400 * time.Millisecond; stats.P90 != expected {
+		t.Errorf("%s != %s", stats.P90, expected)
+	}
+	if len(stats.Stragglers) != 1 || stats.Stragglers[0].Address.IP.String() != "10.0.0.9" {
+		t.Errorf("invalid stragglers: %+v", stats.Stragglers)
+	}
+	if stats.Stragglers[0].Delay != 8100*time.Millisecond {
+		t.Errorf("%s != %s", stats.Stragglers[0].Delay, 8100*time.Millisecond)
+	}
+}
+
+func TestPropagationTrackerPrune(t *testing.T) {
+	tracker := NewPropagationTracker(2)
+	now := time.Now()
+	for level := uint32(1); level <= 4; level++ {
+		tracker.Record(testHeadUpdate(byte(level), level, 1, now))
+	}
+
+	blocks := tracker.Blocks()
+	if len(blocks) != 2 {
+		t.Fatalf("%d != 2", len(blocks))
+	}
+	if blocks[0].Level != 3 || blocks[1].Level != 4 {
+		t.Errorf("levels %d, %d != 3, 4", blocks[0].Level, blocks[1].Level)
+	}
+
+	// A late announcement of an old block is outside the window
+	if tracker.Record(testHeadUpdate(10, 2, 2, now)) {
+		t.Errorf("block outside the window is recorded")
+	}
+	if _, ok := tracker.Block(crypto.BlockHash{10}); ok {
+		t.Errorf("block outside the window is kept")
+	}
+	if blocks := tracker.Blocks(); len(blocks) != 2 || blocks[0].Level != 3 {
+		t.Errorf("window is changed: %+v", blocks)
+	}
+
+	// A new block of the kept level is recorded
+	if !tracker.Record(testHeadUpdate(11, 3, 2, now)) {
+		t.Errorf("block inside the window isn't recorded")
+	}
+}
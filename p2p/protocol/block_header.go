@@ -0,0 +1,95 @@
+package protocol
+
+import (
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+	"golang.org/x/crypto/blake2b"
+)
+
+type byteSlice = []byte
+
+// BlockHeader -
+type BlockHeader struct {
+	Level          uint32
+	Proto          byte
+	Predecessor    crypto.BlockHash
+	Timestamp      int64
+	ValidationPass byte
+	OperationHash  crypto.OperationListListHash
+	Fitness        RawFitness
+	Context        crypto.ContextHash
+	ProtocolData   []byte
+}
+
+// DecodeBlockHeader - decodes the shell header and protocol data of a block.
+func DecodeBlockHeader(data []byte) (BlockHeader, error) {
+	return decodeBlockHeader(newDecoder(data))
+}
+
+// Bytes - encodes the header. DecodeBlockHeader(header.Bytes()) returns the same header.
+func (header BlockHeader) Bytes() []byte {
+	e := new(encoder)
+	header.encode(e)
+	return e.data
+}
+
+// Hash - returns block hash which is blake2b-256 of the encoded header.
+func (header BlockHeader) Hash() crypto.BlockHash {
+	return blake2b.Sum256(header.Bytes())
+}
+
+func decodeBlockHeader(d *decoder) (header BlockHeader, err error) {
+	if header.Level, err = d.uint32(); err != nil {
+		return
+	}
+	if header.Proto, err = d.uint8(); err != nil {
+		return
+	}
+	if err = d.hash(header.Predecessor[:]); err != nil {
+		return
+	}
+	if header.Timestamp, err = d.int64(); err != nil {
+		return
+	}
+	if header.ValidationPass, err = d.uint8(); err != nil {
+		return
+	}
+	if err = d.hash(header.OperationHash[:]); err != nil {
+		return
+	}
+
+	fitness, err := d.dynamic()
+	if err != nil {
+		return
+	}
+	for fitness.remaining() > 0 {
+		element, err := fitness.dynamic()
+		if err != nil {
+			return header, err
+		}
+		header.Fitness = append(header.Fitness, element.rest())
+	}
+
+	if err = d.hash(header.Context[:]); err != nil {
+		return
+	}
+	header.ProtocolData = d.rest()
+	return
+}
+
+func (header BlockHeader) encode(e *encoder) {
+	e.uint32(header.Level)
+	e.uint8(header.Proto)
+	e.bytes(header.Predecessor[:])
+	e.int64(header.Timestamp)
+	e.uint8(header.ValidationPass)
+	e.bytes(header.OperationHash[:])
+	e.dynamic(func(e *encoder) {
+		for _, element := range header.Fitness {
+			e.dynamic(func(e *encoder) {
+				e.bytes(element)
+			})
+		}
+	})
+	e.bytes(header.Context[:])
+	e.bytes(header.ProtocolData)
+}
@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestBlockHeaderBytes(t *testing.T) {
+	data, _ := hex.DecodeString("000306f80146a6aefde9243ae18b191a8d010b7237d5130b3530ce5d1f60457411b2fa632d000000005c73d01c04acecbfac449678f1d68b90c7b7a86c9280fd373d872e072f3fb1b395681e71490000001100000001000000000800000000005ba1ca934484026d24be9ad40c98341c20e51092dd62bbf470bb9ff85061fa981ebbd90000000000031b4f9aff00c6d9a5d1fbf5eda49a01e52017dc78ca1d7a45f3f4fe32840052f9845a61ccdd6cf20139cedef0ed52395a327ad13390d9e8c1e999339a24f8513fe513ed689a")
+
+	header, err := DecodeBlockHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(header.Bytes(), data) {
+		t.Errorf("%x != %x", header.Bytes(), data)
+	}
+
+	decoded, err := DecodeBlockHeader(testBlockHeader().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, testBlockHeader()) {
+		t.Errorf("%+v != %+v", decoded, testBlockHeader())
+	}
+}
+
+func TestBlockHeaderHash(t *testing.T) {
+	header := testBlockHeader()
+	expected := blake2b.Sum256(header.Bytes())
+	if hash := header.Hash(); hash != expected {
+		t.Errorf("%s != %x", hash, expected)
+	}
+
+	header.Level++
+	if header.Hash() == expected {
+		t.Errorf("hash doesn't depend on the level")
+	}
+}
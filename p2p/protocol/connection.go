@@ -1,78 +1,122 @@
 package protocol
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
+	"io"
 	"net"
 	"time"
 
 	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+	"golang.org/x/crypto/nacl/box"
 )
 
-func sendConnectionMessage(conn net.Conn, message ConnectionMessage) (err error) {
+// chunk sizes
+const (
+	chunkLenSize        = 2
+	maxChunkSize        = 1<<16 - 1
+	maxChunkContentSize = maxChunkSize - chunkLenSize - box.Overhead
+)
+
+func sendConnectionMessage(ctx context.Context, conn net.Conn, message ConnectionMessage, timeout time.Duration) (err error) {
 	data := message.toBytes()
 
-	err = conn.SetWriteDeadline(time.Now().Add(time.Second * 6))
-	if err != nil {
-		return
-	}
-	_, err = conn.Write(data)
+	err = conn.SetWriteDeadline(deadline(ctx, timeout))
 	if err != nil {
 		return
 	}
-	return
+	return interruptible(ctx, conn, func() error {
+		_, err := conn.Write(data)
+		return err
+	})
 }
 
-func receiveConnectionMessage(conn net.Conn) (message *ConnectionMessage, err error) {
-	err = conn.SetReadDeadline(time.Now().Add(time.Second * 6))
+func receiveConnectionMessage(ctx context.Context, conn net.Conn, timeout time.Duration) (message *ConnectionMessage, err error) {
+	err = conn.SetReadDeadline(deadline(ctx, timeout))
 	if err != nil {
 		return
 	}
 
-	buf := make([]byte, 1024)
-	received, err := conn.Read(buf)
+	var chunk []byte
+	err = interruptible(ctx, conn, func() (err error) {
+		chunk, err = readChunk(conn)
+		return
+	})
 	if err != nil {
 		return
 	}
 
-	message = newMessage(buf[:received])
-	return
+	return newMessage(addSize(chunk))
 }
 
-func sendEncryptedMessage(conn net.Conn, message []byte, nonce nonceType, precomputedKey *[32]byte) (err error) {
-	// TODO: Split by chunks
-	err = conn.SetWriteDeadline(time.Now().Add(time.Second * 10))
-	if err != nil {
+// readChunk - reads one length-prefixed chunk from the stream. It blocks until the whole chunk is received.
+func readChunk(conn net.Conn) (chunk []byte, err error) {
+	header := make([]byte, chunkLenSize)
+	if _, err = io.ReadFull(conn, header); err != nil {
 		return
 	}
 
-	encrypted, err := crypto.EncryptMessage(message, nonce, precomputedKey)
-	if err != nil {
-		return
+	chunk = make([]byte, binary.BigEndian.Uint16(header))
+	if _, err = io.ReadFull(conn, chunk); err != nil {
+		return nil, err
 	}
+	return
+}
 
-	data := addSize(encrypted)
-	_, err = conn.Write(data)
+// sendEncryptedMessage - splits message into chunks, encrypts every chunk with its own nonce and writes them to the stream.
+// Returns the nonce which has to be used for the next chunk.
+func sendEncryptedMessage(ctx context.Context, conn net.Conn, message []byte, nonce nonceType, precomputedKey *[32]byte, timeout time.Duration) (nextNonce nonceType, err error) {
+	nextNonce = nonce
+	err = conn.SetWriteDeadline(deadline(ctx, timeout))
 	if err != nil {
 		return
 	}
+
+	data := make([]byte, 0, len(message)+chunkLenSize+box.Overhead)
+	for {
+		size := len(message)
+		if size > maxChunkContentSize {
+			size = maxChunkContentSize
+		}
+
+		encrypted, err := crypto.EncryptMessage(message[:size], nextNonce, precomputedKey)
+		if err != nil {
+			return nextNonce, err
+		}
+		data = append(data, addSize(encrypted)...)
+		nextNonce = crypto.NonceIncrement(nextNonce)
+
+		message = message[size:]
+		if len(message) == 0 {
+			break
+		}
+	}
+
+	err = interruptible(ctx, conn, func() error {
+		_, err := conn.Write(data)
+		return err
+	})
 	return
 }
 
-func receiveEncryptedMessage(conn net.Conn, nonce nonceType, precomputedKey *[32]byte) (message []byte, err error) {
-	err = conn.SetReadDeadline(time.Now().Add(time.Second * 10))
+// receiveEncryptedMessage - reads and decrypts one chunk.
+func receiveEncryptedMessage(ctx context.Context, conn net.Conn, nonce nonceType, precomputedKey *[32]byte, timeout time.Duration) (message []byte, err error) {
+	err = conn.SetReadDeadline(deadline(ctx, timeout))
 	if err != nil {
 		return
 	}
 
-	buff := make([]byte, 65536)
-	_, err = conn.Read(buff)
+	var chunk []byte
+	err = interruptible(ctx, conn, func() (err error) {
+		chunk, err = readChunk(conn)
+		return
+	})
 	if err != nil {
 		return
 	}
-	size := binary.BigEndian.Uint16(buff[:2])
 
-	message, success := crypto.DecryptMessage(buff[2:size+2], nonce, precomputedKey)
+	message, success := crypto.DecryptMessage(chunk, nonce, precomputedKey)
 	if !success {
 		return nil, errors.New("can't decrypt the message")
 	}
@@ -80,32 +124,28 @@ func receiveEncryptedMessage(conn net.Conn, nonce nonceType, precomputedKey *[32
 	return
 }
 
-func receiveMetaMessage(conn net.Conn, nonce nonceType, precomputedKey *[32]byte) (message *metadata, err error) {
-	data, err := receiveEncryptedMessage(conn, nonce, precomputedKey)
+func receiveMetaMessage(ctx context.Context, conn net.Conn, nonce nonceType, precomputedKey *[32]byte, timeout time.Duration) (message *metadata, err error) {
+	data, err := receiveEncryptedMessage(ctx, conn, nonce, precomputedKey, timeout)
 	if err != nil {
 		return
 	}
 
-	if len(data) < 2 {
-		return nil, errors.New("received wrong data")
-	}
-
 	message = new(metadata)
-	message.fromBytes(data)
+	if err = message.fromBytes(data); err != nil {
+		return nil, err
+	}
 	return
 }
 
-func receiveAckMessage(conn net.Conn, nonce nonceType, precomputedKey *[32]byte) (message *ackMessage, err error) {
-	data, err := receiveEncryptedMessage(conn, nonce, precomputedKey)
+func receiveAckMessage(ctx context.Context, conn net.Conn, nonce nonceType, precomputedKey *[32]byte, timeout time.Duration) (message *ackMessage, err error) {
+	data, err := receiveEncryptedMessage(ctx, conn, nonce, precomputedKey, timeout)
 	if err != nil {
 		return
 	}
 
-	if len(data) < 1 {
-		return nil, errors.New("received wrong data")
-	}
-
 	message = new(ackMessage)
-	message.fromBytes(data)
+	if err = message.fromBytes(data); err != nil {
+		return nil, err
+	}
 	return
 }
@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"encoding/binary"
+	"fmt"
 	"math/rand"
 	"time"
 )
@@ -15,9 +16,13 @@ type metadata struct {
 	PrivateNode    bool
 }
 
-func (message *metadata) fromBytes(data []byte) {
+func (message *metadata) fromBytes(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("metadata message is too short: %d bytes", len(data))
+	}
 	message.DisableMempool = data[0] != 0
 	message.PrivateNode = data[1] != 0
+	return nil
 }
 
 func (message *metadata) toBytes() []byte {
@@ -36,19 +41,111 @@ func (message *metadata) toBytes() []byte {
 	return arr
 }
 
+// NackMotive - the reason of the connection rejection which is sent in Nack since p2p version 1.
+type NackMotive uint16
+
+// Nack motives
+const (
+	NackNoMotive NackMotive = iota
+	NackTooManyConnections
+	NackUnknownChainName
+	NackDeprecatedP2PVersion
+	NackDeprecatedDistributedDBVersion
+	NackAlreadyConnected
+)
+
+// String -
+func (motive NackMotive) String() string {
+	switch motive {
+	case NackNoMotive:
+		return "no motive"
+	case NackTooManyConnections:
+		return "too many connections"
+	case NackUnknownChainName:
+		return "unknown chain name"
+	case NackDeprecatedP2PVersion:
+		return "deprecated p2p version"
+	case NackDeprecatedDistributedDBVersion:
+		return "deprecated distributed db version"
+	case NackAlreadyConnected:
+		return "already connected"
+	default:
+		return fmt.Sprintf("unknown motive %d", uint16(motive))
+	}
+}
+
+// IsVersionMismatch - reports whether the connection was rejected because of incompatible network versions.
+func (motive NackMotive) IsVersionMismatch() bool {
+	switch motive {
+	case NackUnknownChainName, NackDeprecatedP2PVersion, NackDeprecatedDistributedDBVersion:
+		return true
+	default:
+		return false
+	}
+}
+
+// ack tags
+const (
+	ackTag    = 0x00
+	nackTag   = 0x01
+	nackV0Tag = 0xff
+)
+
 type ackMessage struct {
 	IsNack bool
+	Motive NackMotive
+	Points []string
 }
 
-func (message *ackMessage) fromBytes(data []byte) {
-	message.IsNack = data[0] != 0
+func (message *ackMessage) fromBytes(data []byte) error {
+	d := newDecoder(data)
+	tag, err := d.uint8()
+	if err != nil {
+		return fmt.Errorf("ack message is empty")
+	}
+	message.IsNack = tag != ackTag
+	if tag == nackTag {
+		motive, err := d.uint16()
+		if err != nil {
+			return fmt.Errorf("invalid nack message: %s", err)
+		}
+		message.Motive = NackMotive(motive)
+
+		// nack v1 carries points which the remote proposes to connect instead of it
+		if d.remaining() == 0 {
+			return nil
+		}
+		points, err := d.dynamic()
+		if err != nil {
+			return fmt.Errorf("invalid nack points: %s", err)
+		}
+		for points.remaining() > 0 {
+			point, err := points.string()
+			if err != nil {
+				return fmt.Errorf("invalid nack point: %s", err)
+			}
+			message.Points = append(message.Points, point)
+		}
+	}
+	return nil
 }
 
 func (message *ackMessage) toBytes() (bytes []byte) {
-	if message.IsNack {
-		return []byte{255}
+	if !message.IsNack {
+		return []byte{ackTag}
+	}
+	if message.Motive == NackNoMotive && len(message.Points) == 0 {
+		return []byte{nackV0Tag}
 	}
-	return []byte{0}
+	e := new(encoder)
+	e.uint8(nackTag)
+	e.uint16(uint16(message.Motive))
+	e.dynamic(func(e *encoder) {
+		for _, point := range message.Points {
+			e.string(point)
+		}
+	})
+	return e.data
 }
 
 // ConnectionMessage -
@@ -82,7 +179,6 @@ func NewConnectionMessage(port uint16, versions []Version, publicKey, proofOfWor
 }
 
 const (
-	connectionMessageLenSize       = 2
 	connectionMessagePortSize      = 2
 	connectionMessagePublicKeySize = 32
 	connectionMessageNonceSize     = 24
@@ -111,32 +207,31 @@ func (msg *ConnectionMessage) toBytes() (bytes []byte) {
 	return
 }
 
-func newMessage(bytes []byte) (msg *ConnectionMessage) {
-	if len(bytes) < connectionMessageLenSize+connectionMessagePortSize+connectionMessagePublicKeySize+connectionMessageProofSize+connectionMessageNonceSize {
-		return nil
+func newMessage(bytes []byte) (msg *ConnectionMessage, err error) {
+	d := newDecoder(bytes)
+	size, err := d.uint16()
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection message: %s", err)
 	}
-
-	index := 0
-	sz := binary.BigEndian.Uint16(bytes[index : index+connectionMessageLenSize])
-	if uint16(len(bytes)) != sz+connectionMessageLenSize {
-		return nil
+	if int(size) != d.remaining() {
+		return nil, fmt.Errorf("invalid connection message: size %d doesn't match %d received bytes", size, d.remaining())
 	}
 
 	msg = new(ConnectionMessage)
-	index += connectionMessageLenSize
-
-	msg.Port = binary.BigEndian.Uint16(bytes[index : index+connectionMessagePortSize])
-	index += connectionMessagePortSize
-
-	msg.PublicKey = append(msg.PublicKey, bytes[index:index+connectionMessagePublicKeySize]...)
-	index += connectionMessagePublicKeySize
-
-	msg.ProofOfWorkStamp = append(msg.ProofOfWorkStamp, bytes[index:index+connectionMessageProofSize]...)
-	index += connectionMessageProofSize
-
-	msg.MessageNonce = append(msg.MessageNonce[:], bytes[index:index+connectionMessageNonceSize]...)
-	index += connectionMessageNonceSize
-
-	msg.Versions = bytesToVersions(bytes[index:])
+	if msg.Port, err = d.uint16(); err != nil {
+		return nil, fmt.Errorf("invalid connection message: %s", err)
+	}
+	if msg.PublicKey, err = d.fixed(connectionMessagePublicKeySize); err != nil {
+		return nil, fmt.Errorf("invalid connection message: %s", err)
+	}
+	if msg.ProofOfWorkStamp, err = d.fixed(connectionMessageProofSize); err != nil {
+		return nil, fmt.Errorf("invalid connection message: %s", err)
+	}
+	if msg.MessageNonce, err = d.fixed(connectionMessageNonceSize); err != nil {
+		return nil, fmt.Errorf("invalid connection message: %s", err)
+	}
+	if msg.Versions, err = bytesToVersions(d.rest()); err != nil {
+		return nil, fmt.Errorf("invalid connection message: %s", err)
+	}
 	return
 }
@@ -28,7 +28,10 @@ func TestNewMessage(t *testing.T) {
 
 	for i, v := range messages {
 		data, _ := hex.DecodeString(v)
-		con := newMessage(data)
+		con, err := newMessage(data)
+		if err != nil {
+			t.Fatal(err)
+		}
 
 		if hex.EncodeToString(con.MessageNonce) != expectedNonces[i] {
 			t.Errorf("%s != %s", hex.EncodeToString(con.MessageNonce), expectedNonces[i])
@@ -0,0 +1,196 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type rawMessage []byte
+
+func (msg rawMessage) toBytes() []byte {
+	return msg
+}
+
+func newRawMessage(size int) rawMessage {
+	msg := make([]byte, peerMessageLenSize+size)
+	binary.BigEndian.PutUint32(msg[:peerMessageLenSize], uint32(size))
+	for i := peerMessageLenSize; i < len(msg); i++ {
+		msg[i] = byte(i)
+	}
+	return msg
+}
+
+func newPipePeers() (local *Peer, remote *Peer) {
+	localConn, remoteConn := net.Pipe()
+	nonce, _ := hex.DecodeString("8dde158c55cff52f4be9352787d333e616a67853640d72c5")
+	remoteNonce, _ := hex.DecodeString("e67481a23cf9b404626a12bd405066e161b32dc53f469153")
+	key, _ := hex.DecodeString("5228751a6f5a6494e38e1042f578e3a64ae3462b7899356f49e50be846c9609c")
+
+	local = NewPeer(localConn, net.TCPAddr{})
+	local.localNonce = nonce
+	local.remoteNonce = remoteNonce
+	copy(local.precomputedKey[:], key)
+
+	remote = NewPeer(remoteConn, net.TCPAddr{})
+	remote.localNonce = remoteNonce
+	remote.remoteNonce = nonce
+	copy(remote.precomputedKey[:], key)
+	return
+}
+
+func TestSendReceiveChunkedMessage(t *testing.T) {
+	sizes := [...]int{0, 10, maxChunkContentSize - peerMessageLenSize, maxChunkContentSize, 3*maxChunkContentSize + 17}
+
+	for _, size := range sizes {
+		local, remote := newPipePeers()
+		msg := newRawMessage(size)
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- local.SendMessage(msg)
+		}()
+
+		data, err := remote.receiveData(context.Background(), remote.options.ReadTimeout)
+		if err != nil {
+			t.Errorf("size %d: %s", size, err)
+		}
+		if err := <-errs; err != nil {
+			t.Errorf("size %d: %s", size, err)
+		}
+		if !bytes.Equal(data, msg) {
+			t.Errorf("size %d: received message differs from the sent one", size)
+		}
+		if !bytes.Equal(local.localNonce, remote.remoteNonce) {
+			t.Errorf("size %d: nonces are out of sync", size)
+		}
+		local.conn.Close()
+		remote.conn.Close()
+	}
+}
+
+func TestReceiveFragmentedChunks(t *testing.T) {
+	local, remote := newPipePeers()
+	defer remote.conn.Close()
+
+	first := newRawMessage(2 * maxChunkContentSize)
+	second := newRawMessage(5)
+
+	// Encrypt both messages into a single stream and deliver it byte by byte.
+	var stream bytes.Buffer
+	nonce := local.localNonce
+	for _, msg := range [...]rawMessage{first, second} {
+		writer, reader := net.Pipe()
+		go func(msg rawMessage) {
+			nonce, _ = sendEncryptedMessage(context.Background(), writer, msg, nonce, &local.precomputedKey, DefaultWriteTimeout)
+			writer.Close()
+		}(msg)
+		buf := make([]byte, 4096)
+		for {
+			n, err := reader.Read(buf)
+			stream.Write(buf[:n])
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	go func() {
+		data := stream.Bytes()
+		for i := range data {
+			if _, err := local.conn.Write(data[i : i+1]); err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, expected := range [...]rawMessage{first, second} {
+		data, err := remote.receiveData(context.Background(), remote.options.ReadTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("received message differs from the sent one")
+		}
+	}
+}
+
+func TestInitContextCancel(t *testing.T) {
+	localConn, remoteConn := net.Pipe()
+	defer remoteConn.Close()
+
+	// the remote reads the connection message and keeps silence
+	go io.Copy(io.Discard, remoteConn)
+
+	connMessage, secretKey := newTestConnectionMessage(t, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := NewPeer(localConn, net.TCPAddr{}).InitContext(ctx, connMessage, secretKey)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("%v != %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancellation took %s", elapsed)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := NewPeer(localConn, net.TCPAddr{}).ReceivePeerMessageContext(ctx); !errors.Is(err, context.DeadlineExceeded) && !isTimeout(err) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestInterruptibleResetsDeadline(t *testing.T) {
+	localConn, remoteConn := net.Pipe()
+	defer localConn.Close()
+	defer remoteConn.Close()
+
+	// The context is cancelled when io is already finished, the connection must stay usable
+	ctx, cancel := context.WithCancel(context.Background())
+	err := interruptible(ctx, localConn, func() error {
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go remoteConn.Write([]byte{0x01})
+	buf := make([]byte, 1)
+	if _, err := localConn.Read(buf); err != nil {
+		t.Errorf("connection is interrupted after io: %s", err)
+	}
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+func TestReadTimeoutOption(t *testing.T) {
+	local, remote := newPipePeers()
+	defer local.conn.Close()
+	defer remote.conn.Close()
+
+	remote.SetOptions(Options{ReadTimeout: 50 * time.Millisecond})
+	if remote.options.WriteTimeout != DefaultWriteTimeout {
+		t.Errorf("%s != %s", remote.options.WriteTimeout, DefaultWriteTimeout)
+	}
+
+	start := time.Now()
+	if _, _, err := remote.ReceivePeerMessage(); !isTimeout(err) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("read timeout took %s", elapsed)
+	}
+}
@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// aLongTimeAgo - deadline which interrupts blocked I/O immediately.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// deadline - returns the earlier of now plus timeout and the context deadline.
+// Zero timeout means no timeout, so the zero time is returned if the context has no deadline.
+func deadline(ctx context.Context, timeout time.Duration) time.Time {
+	ctxDeadline, ok := ctx.Deadline()
+	if timeout == 0 {
+		return ctxDeadline
+	}
+	result := time.Now().Add(timeout)
+	if ok && ctxDeadline.Before(result) {
+		return ctxDeadline
+	}
+	return result
+}
+
+// interruptible - runs io on the connection and interrupts it when the context is cancelled.
+// The context error is returned instead of the error of interrupted io.
+func interruptible(ctx context.Context, conn net.Conn, io func() error) error {
+	if ctx.Done() == nil {
+		return io()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(aLongTimeAgo)
+			interrupted <- true
+		case <-done:
+			interrupted <- false
+		}
+	}()
+
+	err := io()
+	close(done)
+	// The watcher may interrupt after io is finished, so the deadline is reset when it exits
+	if <-interrupted {
+		conn.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+// Prefix - base58check prefix of encoded value.
+type Prefix []byte
+
+// base58check prefixes
+var (
+	BlockHashPrefix             = Prefix{1, 52}            // B
+	ChainIDPrefix               = Prefix{87, 82, 0}        // Net
+	OperationHashPrefix         = Prefix{5, 116}           // o
+	OperationListHashPrefix     = Prefix{133, 233}         // Lo
+	OperationListListHashPrefix = Prefix{29, 159, 109}     // LLo
+	ProtocolHashPrefix          = Prefix{2, 170}           // P
+	ContextHashPrefix           = Prefix{79, 199}          // Co
+	PeerIDPrefix                = Prefix{153, 103}         // id
+	PayloadHashPrefix           = Prefix{1, 106, 242}      // vh
+	NonceHashPrefix             = Prefix{69, 220, 169}     // nce
+	SignaturePrefix             = Prefix{4, 130, 43}       // sig
+	BLSSignaturePrefix          = Prefix{40, 171, 64, 207} // BLsig
+)
+
+// signature sizes
+const (
+	SignatureSize    = 64
+	BLSSignatureSize = 96
+)
+
+const checksumSize = 4
+
+// EncodeBase58Check - encodes payload with prefix and checksum.
+func EncodeBase58Check(payload []byte, prefix Prefix) string {
+	return encodeBase58Check(payload, prefix)
+}
+
+// DecodeBase58Check - decodes the string, verifies its checksum and prefix and returns payload of size bytes.
+func DecodeBase58Check(str string, prefix Prefix, size int) ([]byte, error) {
+	data := base58.Decode(str)
+	if len(data) != len(prefix)+size+checksumSize {
+		return nil, fmt.Errorf("invalid base58check length of %q: %d", str, len(data))
+	}
+
+	payload, checksum := data[:len(data)-checksumSize], data[len(data)-checksumSize:]
+	h := sha256.Sum256(payload)
+	hash := sha256.Sum256(h[:])
+	if !bytes.Equal(hash[:checksumSize], checksum) {
+		return nil, fmt.Errorf("invalid base58check checksum of %q", str)
+	}
+	if !bytes.HasPrefix(payload, prefix) {
+		return nil, fmt.Errorf("invalid base58check prefix of %q", str)
+	}
+	return payload[len(prefix):], nil
+}
+
+func decodeHash(data []byte, prefix Prefix, hash []byte) error {
+	payload, err := DecodeBase58Check(string(data), prefix, len(hash))
+	if err != nil {
+		return err
+	}
+	copy(hash, payload)
+	return nil
+}
+
+// HashKind - kind of a hash which defines its base58check prefix.
+type HashKind interface {
+	Prefix() Prefix
+}
+
+// Hash32 - 32-byte hash which is encoded as base58check string with the prefix of its kind.
+type Hash32[K HashKind] [32]byte
+
+// String -
+func (hash Hash32[K]) String() string {
+	var kind K
+	return EncodeBase58Check(hash[:], kind.Prefix())
+}
+
+// MarshalText -
+func (hash Hash32[K]) MarshalText() ([]byte, error) {
+	return []byte(hash.String()), nil
+}
+
+// UnmarshalText -
+func (hash *Hash32[K]) UnmarshalText(data []byte) error {
+	var kind K
+	return decodeHash(data, kind.Prefix(), hash[:])
+}
+
+// Hash16 - 16-byte hash which is encoded as base58check string with the prefix of its kind.
+type Hash16[K HashKind] [16]byte
+
+// String -
+func (hash Hash16[K]) String() string {
+	var kind K
+	return EncodeBase58Check(hash[:], kind.Prefix())
+}
+
+// MarshalText -
+func (hash Hash16[K]) MarshalText() ([]byte, error) {
+	return []byte(hash.String()), nil
+}
+
+// UnmarshalText -
+func (hash *Hash16[K]) UnmarshalText(data []byte) error {
+	var kind K
+	return decodeHash(data, kind.Prefix(), hash[:])
+}
+
+// Hash4 - 4-byte hash which is encoded as base58check string with the prefix of its kind.
+type Hash4[K HashKind] [4]byte
+
+// String -
+func (hash Hash4[K]) String() string {
+	var kind K
+	return EncodeBase58Check(hash[:], kind.Prefix())
+}
+
+// MarshalText -
+func (hash Hash4[K]) MarshalText() ([]byte, error) {
+	return []byte(hash.String()), nil
+}
+
+// UnmarshalText -
+func (hash *Hash4[K]) UnmarshalText(data []byte) error {
+	var kind K
+	return decodeHash(data, kind.Prefix(), hash[:])
+}
+
+// parseHash - parses base58check string of the hash type.
+func parseHash[T any, PT interface {
+	*T
+	UnmarshalText([]byte) error
+}](str string) (hash T, err error) {
+	err = PT(&hash).UnmarshalText([]byte(str))
+	return
+}
+
+// kinds of hashes
+type (
+	blockHashKind             struct{}
+	chainIDKind               struct{}
+	operationHashKind         struct{}
+	operationListHashKind     struct{}
+	operationListListHashKind struct{}
+	protocolHashKind          struct{}
+	contextHashKind           struct{}
+	peerIDKind                struct{}
+	payloadHashKind           struct{}
+	nonceHashKind             struct{}
+)
+
+func (blockHashKind) Prefix() Prefix             { return BlockHashPrefix }
+func (chainIDKind) Prefix() Prefix               { return ChainIDPrefix }
+func (operationHashKind) Prefix() Prefix         { return OperationHashPrefix }
+func (operationListHashKind) Prefix() Prefix     { return OperationListHashPrefix }
+func (operationListListHashKind) Prefix() Prefix { return OperationListListHashPrefix }
+func (protocolHashKind) Prefix() Prefix          { return ProtocolHashPrefix }
+func (contextHashKind) Prefix() Prefix           { return ContextHashPrefix }
+func (peerIDKind) Prefix() Prefix                { return PeerIDPrefix }
+func (payloadHashKind) Prefix() Prefix           { return PayloadHashPrefix }
+func (nonceHashKind) Prefix() Prefix             { return NonceHashPrefix }
+
+// BlockHash - "B..." hash of a block header.
+type BlockHash = Hash32[blockHashKind]
+
+// ParseBlockHash -
+func ParseBlockHash(str string) (BlockHash, error) {
+	return parseHash[BlockHash](str)
+}
+
+// ChainID - "Net..." identifier of a chain.
+type ChainID = Hash4[chainIDKind]
+
+// ParseChainID -
+func ParseChainID(str string) (ChainID, error) {
+	return parseHash[ChainID](str)
+}
+
+// OperationHash - "o..." hash of an operation.
+type OperationHash = Hash32[operationHashKind]
+
+// ParseOperationHash -
+func ParseOperationHash(str string) (OperationHash, error) {
+	return parseHash[OperationHash](str)
+}
+
+// OperationListHash - "Lo..." hash of a list of operations.
+type OperationListHash = Hash32[operationListHashKind]
+
+// ParseOperationListHash -
+func ParseOperationListHash(str string) (OperationListHash, error) {
+	return parseHash[OperationListHash](str)
+}
+
+// OperationListListHash - "LLo..." merkle root of operation lists of a block.
+type OperationListListHash = Hash32[operationListListHashKind]
+
+// ParseOperationListListHash -
+func ParseOperationListListHash(str string) (OperationListListHash, error) {
+	return parseHash[OperationListListHash](str)
+}
+
+// ProtocolHash - "P..." hash of a protocol.
+type ProtocolHash = Hash32[protocolHashKind]
+
+// ParseProtocolHash -
+func ParseProtocolHash(str string) (ProtocolHash, error) {
+	return parseHash[ProtocolHash](str)
+}
+
+// ContextHash - "Co..." hash of a context.
+type ContextHash = Hash32[contextHashKind]
+
+// ParseContextHash -
+func ParseContextHash(str string) (ContextHash, error) {
+	return parseHash[ContextHash](str)
+}
+
+// PeerID - "id..." hash of a peer public key.
+type PeerID = Hash16[peerIDKind]
+
+// ParsePeerID -
+func ParsePeerID(str string) (PeerID, error) {
+	return parseHash[PeerID](str)
+}
+
+// PayloadHash - "vh..." hash of a block payload.
+type PayloadHash = Hash32[payloadHashKind]
+
+// ParsePayloadHash -
+func ParsePayloadHash(str string) (PayloadHash, error) {
+	return parseHash[PayloadHash](str)
+}
+
+// NonceHash - "nce..." hash of a seed nonce.
+type NonceHash = Hash32[nonceHashKind]
+
+// ParseNonceHash -
+func ParseNonceHash(str string) (NonceHash, error) {
+	return parseHash[NonceHash](str)
+}
+
+// Signature - generic "sig..." signature or "BLsig..." BLS signature.
+type Signature []byte
+
+// String -
+func (signature Signature) String() string {
+	if len(signature) == BLSSignatureSize {
+		return EncodeBase58Check(signature, BLSSignaturePrefix)
+	}
+	return EncodeBase58Check(signature, SignaturePrefix)
+}
+
+// MarshalText -
+func (signature Signature) MarshalText() ([]byte, error) {
+	return []byte(signature.String()), nil
+}
+
+// UnmarshalText -
+func (signature *Signature) UnmarshalText(data []byte) error {
+	payload, err := DecodeBase58Check(string(data), SignaturePrefix, SignatureSize)
+	if err != nil {
+		if payload, err = DecodeBase58Check(string(data), BLSSignaturePrefix, BLSSignatureSize); err != nil {
+			return err
+		}
+	}
+	*signature = payload
+	return nil
+}
+
+// ParseSignature -
+func ParseSignature(str string) (signature Signature, err error) {
+	err = signature.UnmarshalText([]byte(str))
+	return
+}
@@ -0,0 +1,115 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func TestHashEncoding(t *testing.T) {
+	chainID, _ := hex.DecodeString("7a06a770")
+	var mainnet ChainID
+	copy(mainnet[:], chainID)
+	if mainnet.String() != "NetXdQprcVkpaWU" {
+		t.Errorf("%s != NetXdQprcVkpaWU", mainnet)
+	}
+
+	genesis, _ := hex.DecodeString("8fcf233671b6a04fcf679d2a381c2544ea6c1ea29ba6157776ed8424c7ccd00b")
+	var block BlockHash
+	copy(block[:], genesis)
+	if block.String() != "BLockGenesisGenesisGenesisGenesisGenesisf79b5d1CoW2" {
+		t.Errorf("%s != BLockGenesisGenesisGenesisGenesisGenesisf79b5d1CoW2", block)
+	}
+
+	parsed, err := ParseBlockHash(block.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != block {
+		t.Errorf("%x != %x", parsed, block)
+	}
+}
+
+func TestHashDecodingErrors(t *testing.T) {
+	inputs := [...]string{
+		"",
+		"NetXdQprcVkpaWU",
+		"BLockGenesisGenesisGenesisGenesisGenesisf79b5d1CoW3",
+		"BLockGenesisGenesisGenesisGenesisGenesisf79b5d1Co",
+	}
+	for _, input := range inputs {
+		if _, err := ParseBlockHash(input); err == nil {
+			t.Errorf("%q is parsed as block hash", input)
+		}
+	}
+}
+
+func TestHashJSON(t *testing.T) {
+	type object struct {
+		Block     BlockHash
+		Chain     ChainID
+		Operation OperationHash
+		Protocol  ProtocolHash
+		Context   ContextHash
+		List      OperationListListHash
+		Peer      PeerID
+	}
+	expected := object{Chain: ChainID{0x7a, 0x06, 0xa7, 0x70}}
+	for i := range expected.Block {
+		expected.Block[i] = byte(i)
+		expected.Operation[i] = byte(i + 1)
+		expected.Protocol[i] = byte(i + 2)
+		expected.Context[i] = byte(i + 3)
+		expected.List[i] = byte(i + 4)
+	}
+	copy(expected.Peer[:], expected.Block[:])
+
+	data, err := json.Marshal(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded object
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != expected {
+		t.Errorf("%+v != %+v", decoded, expected)
+	}
+
+	prefixes := map[string]string{"Block": "B", "Chain": "Net", "Operation": "o", "Protocol": "P", "Context": "Co", "List": "LLo", "Peer": "id"}
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	for field, prefix := range prefixes {
+		if len(raw[field]) < len(prefix) || raw[field][:len(prefix)] != prefix {
+			t.Errorf("%s: %s has no prefix %s", field, raw[field], prefix)
+		}
+	}
+}
+
+func TestSignatureEncoding(t *testing.T) {
+	for _, test := range []struct {
+		size   int
+		prefix string
+	}{
+		{SignatureSize, "sig"},
+		{BLSSignatureSize, "BLsig"},
+	} {
+		signature := make(Signature, test.size)
+		for i := range signature {
+			signature[i] = byte(i)
+		}
+		encoded := signature.String()
+		if len(encoded) < len(test.prefix) || encoded[:len(test.prefix)] != test.prefix {
+			t.Errorf("%s has no %s prefix", encoded, test.prefix)
+		}
+		parsed, err := ParseSignature(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(parsed) != hex.EncodeToString(signature) {
+			t.Errorf("%x != %x", parsed, signature)
+		}
+	}
+}
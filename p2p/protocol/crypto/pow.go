@@ -0,0 +1,149 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	maxDifficulty        = 256
+	targetMantissaBits   = 48
+	targetShift          = 202
+	proofOfWorkStampSize = 24
+)
+
+// proofOfWorkTarget - builds the target for difficulty the same way as octez does (make_pow_target):
+// the 48-bit mantissa is shifted left by 202 - difficulty and the bits below it are set.
+func proofOfWorkTarget(difficulty float64) *big.Int {
+	shift, frac := math.Modf(difficulty)
+
+	var mantissa int64
+	if frac == 0 {
+		mantissa = 1<<targetMantissaBits - 1
+	} else {
+		mantissa = int64(math.Pow(2, targetMantissaBits-frac))
+	}
+
+	target := big.NewInt(mantissa)
+	if int(shift) >= targetShift {
+		return target.Rsh(target, uint(int(shift)-targetShift))
+	}
+	bits := uint(targetShift - int(shift))
+	mask := new(big.Int).Lsh(big.NewInt(1), bits)
+	mask.Sub(mask, big.NewInt(1))
+	return target.Lsh(target, bits).Or(target, mask)
+}
+
+// proofOfWorkHash - hash of the public key and the stamp interpreted as a little-endian number.
+func proofOfWorkHash(publicKey, stamp []byte) *big.Int {
+	data := make([]byte, 0, len(publicKey)+len(stamp))
+	data = append(data, publicKey...)
+	data = append(data, stamp...)
+	hash := blake2b.Sum256(data)
+
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	return new(big.Int).SetBytes(hash[:])
+}
+
+// CheckProofOfWork - reports whether the stamp satisfies difficulty for the public key.
+func CheckProofOfWork(publicKey, stamp []byte, difficulty float64) bool {
+	if difficulty < 0 || difficulty > maxDifficulty {
+		return false
+	}
+	return proofOfWorkHash(publicKey, stamp).Cmp(proofOfWorkTarget(difficulty)) <= 0
+}
+
+// ProofOfWorkDifficulty - returns the difficulty which the stamp actually achieves for the public key.
+// The target of difficulty d is about 2^(250-d), so weak stamps may have negative difficulty.
+func ProofOfWorkDifficulty(publicKey, stamp []byte) float64 {
+	hash := proofOfWorkHash(publicKey, stamp)
+	bitLen := hash.BitLen()
+	if bitLen == 0 {
+		return maxDifficulty
+	}
+
+	// Keep 53 significant bits to fit float64 mantissa
+	shift := 0
+	if bitLen > 53 {
+		shift = bitLen - 53
+		hash.Rsh(hash, uint(shift))
+	}
+	mantissa, _ := new(big.Float).SetInt(hash).Float64()
+	return targetShift + targetMantissaBits - (math.Log2(mantissa) + float64(shift))
+}
+
+// GenerateProofOfWork - searches for a stamp which satisfies difficulty for the public key using workers goroutines.
+func GenerateProofOfWork(publicKey []byte, difficulty float64, workers int) ([]byte, error) {
+	if difficulty < 0 || difficulty > maxDifficulty {
+		return nil, fmt.Errorf("difficulty must be in range [0, %d]: %f", maxDifficulty, difficulty)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	var target [32]byte
+	proofOfWorkTarget(difficulty).FillBytes(target[:])
+
+	found := make(chan []byte, workers)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	for i := 0; i < workers; i++ {
+		start := make([]byte, proofOfWorkStampSize)
+		if _, err := rand.Read(start); err != nil {
+			return nil, err
+		}
+		go searchProofOfWork(publicKey, start, &target, found, stop)
+	}
+	return <-found, nil
+}
+
+func searchProofOfWork(publicKey, stamp []byte, target *[32]byte, found chan<- []byte, stop <-chan struct{}) {
+	data := make([]byte, len(publicKey)+len(stamp))
+	copy(data, publicKey)
+	nonce := data[len(publicKey):]
+	copy(nonce, stamp)
+
+	for attempt := 0; ; attempt++ {
+		if attempt%4096 == 0 {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+
+		hash := blake2b.Sum256(data)
+		if hashBelowTarget(&hash, target) {
+			found <- append([]byte{}, nonce...)
+			return
+		}
+		incrementBytes(nonce)
+	}
+}
+
+// hashBelowTarget - compares the little-endian hash with the big-endian target.
+func hashBelowTarget(hash, target *[32]byte) bool {
+	for i := 0; i < len(hash); i++ {
+		h, t := hash[len(hash)-1-i], target[i]
+		if h != t {
+			return h < t
+		}
+	}
+	return true
+}
+
+func incrementBytes(data []byte) {
+	for i := len(data) - 1; i >= 0; i-- {
+		data[i]++
+		if data[i] != 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestProofOfWorkTarget(t *testing.T) {
+	// octez make_pow_target 26. = (2^48 - 1) << 176 | (2^176 - 1) = 2^224 - 1
+	expected, _ := new(big.Int).SetString("00000000ffffffffffffffffffffffffffffffffffffffffffffffffffffffff", 16)
+	if target := proofOfWorkTarget(26); target.Cmp(expected) != 0 {
+		t.Errorf("%x != %x", target, expected)
+	}
+
+	// 2^(48-0.5) truncated to int64
+	expected = new(big.Int).Lsh(big.NewInt(199032864766430), 176)
+	expected.Or(expected, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 176), big.NewInt(1)))
+	if target := proofOfWorkTarget(26.5); target.Cmp(expected) != 0 {
+		t.Errorf("%x is not the 26.5 target", target)
+	}
+
+	if target := proofOfWorkTarget(0); target.BitLen() != 250 {
+		t.Errorf("zero difficulty target must have 250 bits, but it has %d", target.BitLen())
+	}
+}
+
+func TestProofOfWorkCapturedStamp(t *testing.T) {
+	// identity of a zeronet node from the captured connection message
+	publicKey, _ := hex.DecodeString("911787157ac31ac86ba49ae929ec665c6b955eb51cfcddb8dde96c71cc0f9b25")
+	stamp, _ := hex.DecodeString("36daf0fc3b618be0d6e04396ac77664535295b0c26567214")
+
+	if !CheckProofOfWork(publicKey, stamp, 25) {
+		t.Errorf("stamp doesn't satisfy difficulty 25")
+	}
+	if CheckProofOfWork(publicKey, stamp, 26) {
+		t.Errorf("stamp satisfies difficulty 26")
+	}
+	if difficulty := ProofOfWorkDifficulty(publicKey, stamp); math.Abs(difficulty-25.79) > 0.01 {
+		t.Errorf("%f != 25.79", difficulty)
+	}
+}
+
+func TestCheckProofOfWork(t *testing.T) {
+	publicKey, _ := hex.DecodeString("9e83ee6e795be9551bb11d026034923ff3361fad0b3108b996797c5640588341")
+
+	stamp := make([]byte, 24)
+	const required = 8
+	for i := 0; !CheckProofOfWork(publicKey, stamp, required); i++ {
+		stamp[23], stamp[22], stamp[21] = byte(i), byte(i>>8), byte(i>>16)
+	}
+
+	difficulty := ProofOfWorkDifficulty(publicKey, stamp)
+	if difficulty < required {
+		t.Errorf("achieved difficulty %f is less than required %d", difficulty, required)
+	}
+	if !CheckProofOfWork(publicKey, stamp, difficulty-0.01) {
+		t.Errorf("stamp doesn't satisfy its own difficulty %f", difficulty)
+	}
+	if CheckProofOfWork(publicKey, stamp, difficulty+0.5) {
+		t.Errorf("stamp satisfies difficulty which is higher than achieved %f", difficulty)
+	}
+	if CheckProofOfWork(publicKey, stamp, 257) {
+		t.Errorf("difficulty above 256 must never be satisfied")
+	}
+}
+
+func TestGenerateProofOfWork(t *testing.T) {
+	publicKey, _ := hex.DecodeString("87ae33eef29911bbf1a2cee6386efe1879d5589c85cd2b156d5efed7b1290826")
+
+	for _, difficulty := range []float64{0, 4, 10.5} {
+		stamp, err := GenerateProofOfWork(publicKey, difficulty, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stamp) != proofOfWorkStampSize {
+			t.Errorf("stamp size %d != %d", len(stamp), proofOfWorkStampSize)
+		}
+		if !CheckProofOfWork(publicKey, stamp, difficulty) {
+			t.Errorf("generated stamp doesn't satisfy difficulty %f", difficulty)
+		}
+	}
+
+	if _, err := GenerateProofOfWork(publicKey, 300, 1); err == nil {
+		t.Errorf("difficulty above 256 must be rejected")
+	}
+}
@@ -9,14 +9,7 @@ import (
 	"golang.org/x/crypto/nacl/box"
 )
 
-type prefix = []byte
-
-var (
-	// For (de)constructing addresses
-	publicKeyHash = []byte{153, 103}
-)
-
-func encodeBase58Check(payload []byte, prefix prefix) string {
+func encodeBase58Check(payload []byte, prefix Prefix) string {
 	var data []byte
 	data = append(data, prefix...)
 	data = append(data, payload...)
@@ -42,7 +35,7 @@ func CalcPeerID(publicKey []byte) (peerID string, err error) {
 	}
 
 	peerIDBuff := cryptoBlake.Sum(nil)
-	peerID = encodeBase58Check(peerIDBuff, publicKeyHash)
+	peerID = encodeBase58Check(peerIDBuff, PeerIDPrefix)
 
 	return
 }
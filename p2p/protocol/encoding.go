@@ -0,0 +1,211 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	hashSize       = 32
+	dynamicLenSize = 4
+)
+
+// decoder - reads values in the Tezos binary encoding. Every method checks that enough data is left.
+type decoder struct {
+	data   []byte
+	offset int
+}
+
+func newDecoder(data []byte) *decoder {
+	return &decoder{data: data}
+}
+
+func (d *decoder) remaining() int {
+	return len(d.data) - d.offset
+}
+
+func (d *decoder) next(size int) ([]byte, error) {
+	if size < 0 || size > d.remaining() {
+		return nil, fmt.Errorf("unexpected end of data: need %d bytes at offset %d, but only %d left", size, d.offset, d.remaining())
+	}
+	data := d.data[d.offset : d.offset+size]
+	d.offset += size
+	return data, nil
+}
+
+func (d *decoder) uint8() (byte, error) {
+	data, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return data[0], nil
+}
+
+func (d *decoder) bool() (bool, error) {
+	value, err := d.uint8()
+	return value != 0, err
+}
+
+func (d *decoder) uint16() (uint16, error) {
+	data, err := d.next(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(data), nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	data, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(data), nil
+}
+
+func (d *decoder) int64() (int64, error) {
+	data, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(data)), nil
+}
+
+// fixed - returns a copy of the next size bytes.
+func (d *decoder) fixed(size int) ([]byte, error) {
+	data, err := d.next(size)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, data...), nil
+}
+
+// rest - returns a copy of all remaining bytes.
+func (d *decoder) rest() []byte {
+	data, _ := d.fixed(d.remaining())
+	return data
+}
+
+// dynamic - reads a 4-byte size prefix and returns a decoder over the prefixed data.
+func (d *decoder) dynamic() (*decoder, error) {
+	size, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(size) > uint64(d.remaining()) {
+		return nil, fmt.Errorf("dynamic size %d at offset %d exceeds %d remaining bytes", size, d.offset-dynamicLenSize, d.remaining())
+	}
+	data, err := d.next(int(size))
+	if err != nil {
+		return nil, err
+	}
+	return newDecoder(data), nil
+}
+
+func (d *decoder) string() (string, error) {
+	sub, err := d.dynamic()
+	if err != nil {
+		return "", err
+	}
+	return string(sub.data), nil
+}
+
+// hash - reads len(hash) bytes into hash.
+func (d *decoder) hash(hash []byte) error {
+	data, err := d.fixed(len(hash))
+	if err != nil {
+		return err
+	}
+	copy(hash, data)
+	return nil
+}
+
+// decodeHashes - reads fixed-size hashes until the end of data.
+func decodeHashes[T ~[hashSize]byte](d *decoder) ([]T, error) {
+	if d.remaining()%hashSize != 0 {
+		return nil, fmt.Errorf("hash list size %d is not a multiple of %d", d.remaining(), hashSize)
+	}
+	hashes := make([]T, d.remaining()/hashSize)
+	for i := range hashes {
+		if err := d.hash(hashes[i][:]); err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
+
+// encoder - writes values in the Tezos binary encoding.
+type encoder struct {
+	data []byte
+}
+
+func (e *encoder) uint8(value byte) {
+	e.data = append(e.data, value)
+}
+
+func (e *encoder) bool(value bool) {
+	if value {
+		e.uint8(255)
+	} else {
+		e.uint8(0)
+	}
+}
+
+func (e *encoder) uint16(value uint16) {
+	var buf [2]byte
+	binary.BigEndian.PutUint16(buf[:], value)
+	e.data = append(e.data, buf[:]...)
+}
+
+func (e *encoder) uint32(value uint32) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], value)
+	e.data = append(e.data, buf[:]...)
+}
+
+func (e *encoder) int64(value int64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(value))
+	e.data = append(e.data, buf[:]...)
+}
+
+// fixed - writes exactly size bytes: value is truncated or padded with zeros.
+func (e *encoder) fixed(value []byte, size int) {
+	buf := make([]byte, size)
+	copy(buf, value)
+	e.data = append(e.data, buf...)
+}
+
+func (e *encoder) bytes(value []byte) {
+	e.data = append(e.data, value...)
+}
+
+// dynamic - writes data produced by write with a 4-byte size prefix.
+func (e *encoder) dynamic(write func(e *encoder)) {
+	start := len(e.data)
+	e.uint32(0)
+	write(e)
+	binary.BigEndian.PutUint32(e.data[start:start+dynamicLenSize], uint32(len(e.data)-start-dynamicLenSize))
+}
+
+func (e *encoder) string(value string) {
+	e.uint32(uint32(len(value)))
+	e.data = append(e.data, value...)
+}
+
+func encodeHashes[T ~[hashSize]byte](e *encoder, hashes []T) {
+	for i := range hashes {
+		e.bytes(hashes[i][:])
+	}
+}
+
+// encodeMessage - encodes a peer message: 4-byte size, 2-byte tag and the body.
+func encodeMessage(tag PeerMessageType, write func(e *encoder)) []byte {
+	e := new(encoder)
+	e.dynamic(func(e *encoder) {
+		e.uint16(tag)
+		if write != nil {
+			write(e)
+		}
+	})
+	return e.data
+}
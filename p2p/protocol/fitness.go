@@ -0,0 +1,128 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// fitness versions
+const (
+	FitnessVersionEmmy       = 0x00
+	FitnessVersionEmmyPlus   = 0x01
+	FitnessVersionTenderbake = 0x02
+)
+
+// RawFitness - fitness as it's encoded in block header: list of byte sequences which is compared by the shell.
+type RawFitness []byteSlice
+
+// Compare - compares fitness the same way as the shell does: the longer list is greater,
+// lists of the same length are compared element by element, where the longer element is greater
+// and elements of the same length are compared as bytes. Result is -1, 0 or 1.
+func (fitness RawFitness) Compare(other RawFitness) int {
+	if len(fitness) != len(other) {
+		return compareInts(len(fitness), len(other))
+	}
+	for i := range fitness {
+		if len(fitness[i]) != len(other[i]) {
+			return compareInts(len(fitness[i]), len(other[i]))
+		}
+		if result := bytes.Compare(fitness[i], other[i]); result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+// MarshalJSON - fitness is marshaled as a list of hex strings like octez RPC does.
+func (fitness RawFitness) MarshalJSON() ([]byte, error) {
+	elements := make([]string, len(fitness))
+	for i := range fitness {
+		elements[i] = hex.EncodeToString(fitness[i])
+	}
+	return json.Marshal(elements)
+}
+
+// UnmarshalJSON -
+func (fitness *RawFitness) UnmarshalJSON(data []byte) error {
+	var elements []string
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return err
+	}
+	decoded := make(RawFitness, len(elements))
+	for i := range elements {
+		element, err := hex.DecodeString(elements[i])
+		if err != nil {
+			return err
+		}
+		decoded[i] = element
+	}
+	*fitness = decoded
+	return nil
+}
+
+// Fitness - decoded fitness. Score is set for emmy protocols only,
+// level and rounds are set for tenderbake protocols only.
+type Fitness struct {
+	Version          uint8  `json:"version"`
+	Score            int64  `json:"score,omitempty"`
+	Level            int32  `json:"level,omitempty"`
+	LockedRound      *int32 `json:"locked_round,omitempty"`
+	PredecessorRound int32  `json:"predecessor_round,omitempty"`
+	Round            int32  `json:"round,omitempty"`
+}
+
+// Decode - decodes fitness of emmy and tenderbake protocol families.
+func (fitness RawFitness) Decode() (decoded Fitness, err error) {
+	if len(fitness) == 0 || len(fitness[0]) != 1 {
+		return decoded, fmt.Errorf("invalid fitness version: %x", fitness)
+	}
+	decoded.Version = fitness[0][0]
+
+	switch decoded.Version {
+	case FitnessVersionEmmy, FitnessVersionEmmyPlus:
+		if len(fitness) != 2 || len(fitness[1]) != 8 {
+			return decoded, fmt.Errorf("invalid emmy fitness: %x", fitness)
+		}
+		decoded.Score = int64(binary.BigEndian.Uint64(fitness[1]))
+
+	case FitnessVersionTenderbake:
+		if len(fitness) != 5 || len(fitness[1]) != 4 || len(fitness[3]) != 4 || len(fitness[4]) != 4 {
+			return decoded, fmt.Errorf("invalid tenderbake fitness: %x", fitness)
+		}
+		decoded.Level = int32(binary.BigEndian.Uint32(fitness[1]))
+		switch len(fitness[2]) {
+		case 0:
+		case 4:
+			lockedRound := int32(binary.BigEndian.Uint32(fitness[2]))
+			decoded.LockedRound = &lockedRound
+		default:
+			return decoded, fmt.Errorf("invalid tenderbake locked round: %x", fitness[2])
+		}
+		// predecessor round is stored as -round-1, so the lower round is the greater fitness
+		decoded.PredecessorRound = -int32(binary.BigEndian.Uint32(fitness[3])) - 1
+		decoded.Round = int32(binary.BigEndian.Uint32(fitness[4]))
+
+	default:
+		return decoded, fmt.Errorf("unknown fitness version: %d", decoded.Version)
+	}
+	return
+}
+
+// CompareHeads - compares block headers by fitness. Result is -1, 0 or 1.
+func CompareHeads(a, b BlockHeader) int {
+	return a.Fitness.Compare(b.Fitness)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,95 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func fitnessFromHex(elements ...string) (fitness RawFitness) {
+	for _, element := range elements {
+		data, _ := hex.DecodeString(element)
+		fitness = append(fitness, data)
+	}
+	return
+}
+
+func TestFitnessCompare(t *testing.T) {
+	tests := []struct {
+		a, b     RawFitness
+		expected int
+	}{
+		{fitnessFromHex("01", "0000000000000010"), fitnessFromHex("01", "0000000000000010"), 0},
+		{fitnessFromHex("01", "0000000000000010"), fitnessFromHex("01", "0000000000000011"), -1},
+		{fitnessFromHex("02", "00000010", "", "ffffffff", "00000000"), fitnessFromHex("01", "0000000000000011"), 1},
+		{fitnessFromHex("02", "00000010", "", "ffffffff", "00000000"), fitnessFromHex("02", "00000010", "00000000", "ffffffff", "00000000"), -1},
+		{fitnessFromHex("02", "00000011", "", "ffffffff", "00000000"), fitnessFromHex("02", "00000010", "", "ffffffff", "00000001"), 1},
+		{fitnessFromHex("02", "00000010", "", "ffffffff", "00000001"), fitnessFromHex("02", "00000010", "", "fffffffe", "00000000"), 1},
+		{nil, fitnessFromHex("00"), -1},
+	}
+
+	for i, test := range tests {
+		if result := test.a.Compare(test.b); result != test.expected {
+			t.Errorf("%d: %d != %d", i, result, test.expected)
+		}
+		if result := test.b.Compare(test.a); result != -test.expected {
+			t.Errorf("%d: reversed %d != %d", i, result, -test.expected)
+		}
+	}
+}
+
+func TestFitnessDecode(t *testing.T) {
+	lockedRound := int32(1)
+	tests := []struct {
+		fitness  RawFitness
+		expected Fitness
+	}{
+		{fitnessFromHex("00", "00000000005ba1ca"), Fitness{Version: FitnessVersionEmmy, Score: 0x5ba1ca}},
+		{fitnessFromHex("01", "0000000000011d80"), Fitness{Version: FitnessVersionEmmyPlus, Score: 0x11d80}},
+		{fitnessFromHex("02", "001d9a3a", "", "ffffffff", "00000000"), Fitness{Version: FitnessVersionTenderbake, Level: 1940026}},
+		{fitnessFromHex("02", "001d9a3a", "00000001", "fffffffe", "00000002"), Fitness{Version: FitnessVersionTenderbake, Level: 1940026, LockedRound: &lockedRound, PredecessorRound: 1, Round: 2}},
+	}
+
+	for _, test := range tests {
+		decoded, err := test.fitness.Decode()
+		if err != nil {
+			t.Errorf("%x: %s", test.fitness, err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded, test.expected) {
+			t.Errorf("%x: %+v != %+v", test.fitness, decoded, test.expected)
+		}
+	}
+
+	invalid := []RawFitness{
+		nil,
+		fitnessFromHex("03", "00"),
+		fitnessFromHex("01", "0000"),
+		fitnessFromHex("02", "001d9a3a", "00", "ffffffff", "00000000"),
+	}
+	for _, fitness := range invalid {
+		if _, err := fitness.Decode(); err == nil {
+			t.Errorf("%x is decoded without error", fitness)
+		}
+	}
+}
+
+func TestFitnessJSON(t *testing.T) {
+	fitness := fitnessFromHex("02", "001d9a3a", "", "ffffffff", "00000000")
+	data, err := json.Marshal(fitness)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `["02","001d9a3a","","ffffffff","00000000"]` {
+		t.Errorf("unexpected JSON %s", data)
+	}
+
+	var decoded RawFitness
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Compare(fitness) != 0 {
+		t.Errorf("%x != %x", decoded, fitness)
+	}
+}
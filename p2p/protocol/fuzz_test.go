@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+func FuzzParseMessage(f *testing.F) {
+	seeds := []peerMessage{
+		BootstrapMsg{},
+		AdvertiseMsg{Addresses: []string{"234.123.124.91:9876"}},
+		SwapRequestMsg{Point: "234.123.124.91:9876", PeerID: testPeerID(1)},
+		GetCurrentBranchMsg{ChainID: testChainID},
+		CurrentBranchMsg{ChainID: testChainID, Locator: BlockLocator{CurrentHead: testBlockHeader(), History: []crypto.BlockHash{testHash(2)}}},
+		GetCurrentHeadMsg{ChainID: testChainID},
+		CurrentHeadMsg{ChainID: testChainID, CurrentBlockHeader: testBlockHeader(), Mempool: Mempool{KnownValid: []crypto.OperationHash{crypto.OperationHash(testHash(3))}}},
+		GetBlockHeadersMsg{Hashes: []crypto.BlockHash{testHash(4)}},
+		OperationMsg{Operation: Operation{Branch: testHash(5), Data: []byte{1}}},
+		ProtocolMsg{Protocol: Protocol{Components: []ProtocolComponent{{Name: "Main", Implementation: "let x = 1"}}}},
+		GetOperationsForBlocksMsg{Blocks: []OperationsForBlock{{Hash: testHash(6), ValidationPass: 2}}},
+		OperationsForBlocksMsg{Path: []PathStep{{Left: true, Hash: crypto.OperationListListHash(testHash(7))}}, Operations: []Operation{{Branch: testHash(8)}}},
+	}
+	for _, seed := range seeds {
+		f.Add(seed.toBytes())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, msgType, err := parseMessage(data)
+		if err != nil {
+			return
+		}
+		encodable, ok := msg.(peerMessage)
+		if !ok {
+			return
+		}
+		if _, again, err := parseMessage(encodable.toBytes()); err != nil || again != msgType {
+			t.Errorf("re-encoded message of type %d can't be parsed: %v", msgType, err)
+		}
+	})
+}
+
+func FuzzNewCurrentHeadMsg(f *testing.F) {
+	f.Add(CurrentHeadMsg{ChainID: testChainID, CurrentBlockHeader: testBlockHeader()}.toBytes()[peerMessageLenSize+peerMessageTypeSize:])
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = NewCurrentHeadMsg(data)
+	})
+}
+
+func FuzzNewAdvertiseMsg(f *testing.F) {
+	data, _ := hex.DecodeString("0000001e5b666538303a3a653832383a323039643a3230653a633061655d3a333735000000133233342e3132332e3132342e39313a39383736")
+	f.Add(data)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = newAdvertiseMsg(data)
+	})
+}
+
+func FuzzNewConnectionMessage(f *testing.F) {
+	data, _ := hex.DecodeString("007c2604911787157ac31ac86ba49ae929ec665c6b955eb51cfcddb8dde96c71cc0f9b2536daf0fc3b618be0d6e04396ac77664535295b0c2656721493d6c99cc0d985948a128278b3c02f42499d9fddbc7693020000002254455a4f535f5a45524f4e45545f323031392d30382d30365431353a31383a35365a00000000")
+	f.Add(data)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := newMessage(data)
+		if err != nil {
+			return
+		}
+		if _, err := newMessage(msg.toBytes()); err != nil {
+			t.Errorf("re-encoded connection message can't be parsed: %s", err)
+		}
+	})
+}
+
+func FuzzBytesToVersions(f *testing.F) {
+	data, _ := hex.DecodeString("0000000d54455a4f535f4d41494e4e455400010002")
+	f.Add(data)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = bytesToVersions(data)
+	})
+}
+
+func FuzzConnectionMetadata(f *testing.F) {
+	f.Add([]byte{0, 1})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_ = new(metadata).fromBytes(data)
+		_ = new(ackMessage).fromBytes(data)
+	})
+}
@@ -1,53 +1,66 @@
 package protocol
 
 import (
-	"fmt"
+	"context"
 	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
 )
 
-func (peer *Peer) getHead() (head CurrentHeadMsg, err error) {
-	// Receiving first maeesage from node GetCurrentBranch
-	msg, msgType, err := peer.ReceivePeerMessage()
-	if err != nil {
-		return head, err
-	}
+func (peer *Peer) getHead(ctx context.Context) (head CurrentHeadMsg, err error) {
+	session := peer.Session()
 
-	if msgType != GetCurrentBranchTag {
-		return head, fmt.Errorf("message has a different type: %d", msgType)
-	}
+	ctx, cancel := context.WithTimeout(ctx, DefaultRequestTimeout)
+	defer cancel()
 
-	currentBranch := msg.(GetCurrentBranchMsg).Branch
-	// Response on node request CurrentBranchMsg
-	if err = peer.SendMessage(CurrentHeadMsg{ChainID: currentBranch}); err != nil {
-		return
-	}
-	if _, _, err = peer.ReceivePeerMessage(); err != nil {
-		return
+	// Only the head of the configured chain is accepted, so peers of other networks don't reply
+	chainID := peer.options.ChainID
+	if chainID == (crypto.ChainID{}) {
+		// The remote requests our branch right after the connection, so its chain is known from the request.
+		// The request is answered by the session when the remote's head is received.
+		if chainID, err = session.ChainIDContext(ctx); err != nil {
+			return
+		}
 	}
+	return session.GetCurrentHeadContext(ctx, chainID)
+}
 
-	// Request current head
-	if err = peer.SendMessage(GetCurrentHeadMsg{ChainID: currentBranch}); err != nil {
-		return
+// currentBranch - returns the supplied block locator or builds the locator from the peer's head.
+func (peer *Peer) currentBranch(chainID crypto.ChainID, head CurrentHeadMsg) CurrentBranchMsg {
+	if peer.locator != nil {
+		return CurrentBranchMsg{
+			ChainID: chainID,
+			Locator: *peer.locator,
+		}
 	}
-	// Receiving current head
-	msg, msgType, err = peer.ReceivePeerMessage()
-	if err != nil {
-		return
-	}
-	if msgType != CurrentHeadTag {
-		return head, fmt.Errorf("message has a different type: %d", msgType)
+	return CurrentBranchMsg{
+		ChainID: chainID,
+		Locator: BlockLocator{
+			CurrentHead: head.CurrentBlockHeader,
+			History:     []crypto.BlockHash{head.CurrentBlockHeader.Predecessor},
+		},
 	}
-	head = msg.(CurrentHeadMsg)
-	return
 }
 
 // UpdateSyncState -
 func (peer *Peer) UpdateSyncState(syncedTime int64) error {
-	currentHead, err := peer.getHead()
+	return peer.UpdateSyncStateContext(context.Background(), syncedTime)
+}
+
+// UpdateSyncStateContext - requests the current head of the peer until the context is done and updates sync state.
+func (peer *Peer) UpdateSyncStateContext(ctx context.Context, syncedTime int64) error {
+	currentHead, err := peer.getHead(ctx)
 	if err != nil {
 		return err
 	}
 	diff := time.Now().Unix() - currentHead.CurrentBlockHeader.Timestamp
 	peer.Synced = diff < syncedTime
+	head := currentHead.CurrentBlockHeader.Hash()
+	peer.Head = &head
+	peer.Level = currentHead.CurrentBlockHeader.Level
+	peer.Fitness = currentHead.CurrentBlockHeader.Fitness
+	if protocolData, err := currentHead.CurrentBlockHeader.DecodeProtocolData(); err == nil {
+		peer.ProtocolData = &protocolData
+	}
 	return nil
 }
@@ -0,0 +1,138 @@
+package protocol
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+func serveCurrentBranchRequest(remote *Peer, head CurrentHeadMsg) (branch CurrentBranchMsg, err error) {
+	if err = remote.SendMessage(GetCurrentBranchMsg{ChainID: head.ChainID}); err != nil {
+		return
+	}
+	// An unrelated request before the reply must be skipped
+	if err = remote.SendMessage(GetCurrentHeadMsg{ChainID: head.ChainID}); err != nil {
+		return
+	}
+
+	// Replies of the local side may arrive in any order
+	var headSent, branchReceived bool
+	for !headSent || !branchReceived {
+		msg, msgType, err := remote.ReceivePeerMessage()
+		if err != nil {
+			return branch, err
+		}
+		switch msgType {
+		case GetCurrentHeadTag:
+			if err = remote.SendMessage(head); err != nil {
+				return branch, err
+			}
+			headSent = true
+		case CurrentBranchTag:
+			branch = msg.(CurrentBranchMsg)
+			branchReceived = true
+		}
+	}
+	return
+}
+
+func TestGetHeadRepliesWithCurrentBranch(t *testing.T) {
+	head := CurrentHeadMsg{ChainID: testChainID, CurrentBlockHeader: testBlockHeader()}
+	supplied := &BlockLocator{CurrentHead: testBlockHeader(), History: []crypto.BlockHash{testHash(30), testHash(31)}}
+	supplied.CurrentHead.Level = 1
+
+	tests := []struct {
+		locator  *BlockLocator
+		expected BlockLocator
+	}{
+		{nil, BlockLocator{CurrentHead: head.CurrentBlockHeader, History: []crypto.BlockHash{head.CurrentBlockHeader.Predecessor}}},
+		{supplied, *supplied},
+	}
+
+	for _, test := range tests {
+		local, remote := newPipePeers()
+		local.SetBlockLocator(test.locator)
+
+		type result struct {
+			branch CurrentBranchMsg
+			err    error
+		}
+		results := make(chan result, 1)
+		go func() {
+			branch, err := serveCurrentBranchRequest(remote, head)
+			results <- result{branch, err}
+		}()
+
+		received, err := local.getHead(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if received.CurrentBlockHeader.Level != head.CurrentBlockHeader.Level {
+			t.Errorf("level %d != %d", received.CurrentBlockHeader.Level, head.CurrentBlockHeader.Level)
+		}
+
+		res := <-results
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		if res.branch.ChainID != head.ChainID {
+			t.Errorf("%s != %s", res.branch.ChainID, head.ChainID)
+		}
+		if !reflect.DeepEqual(res.branch.Locator, test.expected) {
+			t.Errorf("%+v != %+v", res.branch.Locator, test.expected)
+		}
+		local.conn.Close()
+		remote.conn.Close()
+	}
+}
+
+func TestGetHeadConfiguredChain(t *testing.T) {
+	head := CurrentHeadMsg{ChainID: testChainID, CurrentBlockHeader: testBlockHeader()}
+	other := CurrentHeadMsg{ChainID: crypto.ChainID{0x7a, 0x06, 0xa7, 0x70}, CurrentBlockHeader: testBlockHeader()}
+	other.CurrentBlockHeader.Level = head.CurrentBlockHeader.Level + 1
+
+	local, remote := newPipePeers()
+	defer local.conn.Close()
+	defer remote.conn.Close()
+	local.SetOptions(Options{ChainID: testChainID})
+
+	requested := make(chan crypto.ChainID, 1)
+	go func() {
+		// The remote is on another chain too: its branch request and head must be ignored
+		if err := remote.SendMessage(GetCurrentBranchMsg{ChainID: other.ChainID}); err != nil {
+			return
+		}
+		for {
+			msg, msgType, err := remote.ReceivePeerMessage()
+			if err != nil {
+				return
+			}
+			if msgType != GetCurrentHeadTag {
+				continue
+			}
+			requested <- msg.(GetCurrentHeadMsg).ChainID
+			if err := remote.SendMessage(other); err != nil {
+				return
+			}
+			if err := remote.SendMessage(head); err != nil {
+				return
+			}
+		}
+	}()
+
+	received, err := local.getHead(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chainID := <-requested; chainID != testChainID {
+		t.Errorf("requested chain %s != %s", chainID, testChainID)
+	}
+	if received.ChainID != testChainID {
+		t.Errorf("%s != %s", received.ChainID, testChainID)
+	}
+	if received.CurrentBlockHeader.Level != head.CurrentBlockHeader.Level {
+		t.Errorf("level %d != %d", received.CurrentBlockHeader.Level, head.CurrentBlockHeader.Level)
+	}
+}
@@ -1,59 +1,43 @@
 package protocol
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"net"
 )
 
-// GetPeersAddresses -
+// GetPeersAddresses - requests known points of the remote.
 func (peer *Peer) GetPeersAddresses() ([]*Peer, error) {
-	if err := peer.SendMessage(BootstrapMsg{}); err != nil {
-		return nil, err
-	}
-	msg, _, err := peer.ReceivePeerMessage()
-	if err != nil {
-		return nil, err
-	}
-	if err := peer.parseMessage(msg); err != nil {
-		return nil, err
-	}
+	return peer.GetPeersAddressesContext(context.Background())
+}
 
-	if err := peer.SendMessage(BootstrapMsg{}); err != nil {
-		return nil, err
-	}
-	msg, _, err = peer.ReceivePeerMessage()
+// GetPeersAddressesContext - requests known points of the remote until the context is done.
+func (peer *Peer) GetPeersAddressesContext(ctx context.Context) ([]*Peer, error) {
+	ctx, cancel := context.WithTimeout(ctx, DefaultRequestTimeout)
+	defer cancel()
+
+	msg, err := peer.Session().RequestContext(ctx, BootstrapMsg{}, MatchTag(AdvertiseTag))
 	if err != nil {
 		return nil, err
 	}
-	if err := peer.parseMessage(msg); err != nil {
-		return nil, err
-	}
-
+	peer.Neighbors = msg.(AdvertiseMsg).Addresses
 	return getNeighborsTCPAddress(peer.Neighbors), nil
 }
 
-func (peer *Peer) parseMessage(msg interface{}) error {
-	switch message := msg.(type) {
-	case AdvertiseMsg:
-		peer.Neighbors = message.Addresses
-	case CurrentHeadMsg:
-	case GetCurrentBranchMsg:
-	default:
-		return fmt.Errorf("Unknown message type: %T", msg)
-	}
-	return nil
+// PeersFromPoints - creates peers of "host:port" points. Points which can't be resolved are skipped.
+func PeersFromPoints(points []string) []*Peer {
+	return getNeighborsTCPAddress(points)
 }
 
 func getNeighborsTCPAddress(peersAddress []string) []*Peer {
-	neighbors := make([]*Peer, len(peersAddress))
-	for i, peer := range peersAddress {
-		neighbors[i] = &Peer{}
+	neighbors := make([]*Peer, 0, len(peersAddress))
+	for _, peer := range peersAddress {
 		addr, err := net.ResolveTCPAddr("tcp", peer)
 		if err != nil {
 			log.Printf("Resolve tcp address error: %s", err)
+			continue
 		}
-		neighbors[i].Address = *addr
+		neighbors = append(neighbors, &Peer{Address: *addr})
 	}
 	return neighbors
 }
@@ -0,0 +1,169 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/dialer"
+)
+
+// Listener - accepts incoming connections and performs the responder side of the handshake.
+// Peers which have passed the handshake are sent to the Peers channel. Receiver has to close them.
+type Listener struct {
+	listener    net.Listener
+	connMessage ConnectionMessage
+	secretKey   []byte
+	options     Options
+	powMode     ProofOfWorkMode
+	powRequired float64
+	versions    *NetworkVersions
+	dialer      dialer.Dialer
+
+	peers  chan *Peer
+	ctx    context.Context
+	cancel context.CancelFunc
+	mutex  sync.RWMutex
+	wg     sync.WaitGroup
+}
+
+// NewListener - starts listening on address. connMessage is used as a template: every connection gets its own nonce.
+func NewListener(address string, connMessage ConnectionMessage, secretKey []byte, disableMempool, privateNode bool) (*Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Listener{
+		listener:    listener,
+		connMessage: connMessage,
+		secretKey:   secretKey,
+		options: Options{
+			DisableMempool: disableMempool,
+			PrivateNode:    privateNode,
+		}.WithDefaults(),
+		peers: make(chan *Peer, 1024),
+	}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+
+	l.wg.Add(1)
+	go l.accept()
+	return l, nil
+}
+
+// SetProofOfWorkCheck - sets how proof-of-work stamps of incoming peers are verified.
+func (l *Listener) SetProofOfWorkCheck(mode ProofOfWorkMode, difficulty float64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.powMode = mode
+	l.powRequired = difficulty
+}
+
+// SetOptions - sets timeouts of incoming connections and metadata which is announced to incoming peers.
+// ListeningPort isn't used: the port of the connection message template is announced.
+func (l *Listener) SetOptions(options Options) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.options = options.WithDefaults()
+}
+
+// SetDialer - sets the dialer which is used by RPC probes of incoming peers.
+func (l *Listener) SetDialer(d dialer.Dialer) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.dialer = d
+}
+
+// SetNetworkVersions - sets versions which are negotiated with incoming peers.
+func (l *Listener) SetNetworkVersions(versions NetworkVersions) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.versions = &versions
+}
+
+// Addr -
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Peers -
+func (l *Listener) Peers() <-chan *Peer {
+	return l.peers
+}
+
+// Close - stops accepting connections, interrupts pending handshakes and closes the Peers channel when they are finished.
+func (l *Listener) Close() error {
+	err := l.listener.Close()
+	l.cancel()
+	l.wg.Wait()
+	close(l.peers)
+	return err
+}
+
+func (l *Listener) accept() {
+	defer l.wg.Done()
+
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Accept error: %s", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		l.wg.Add(1)
+		go l.handshake(conn)
+	}
+}
+
+func (l *Listener) handshake(conn net.Conn) {
+	defer l.wg.Done()
+
+	tcpAddr, _ := conn.RemoteAddr().(*net.TCPAddr)
+	address := net.TCPAddr{}
+	if tcpAddr != nil {
+		address = *tcpAddr
+	}
+
+	peer := NewPeer(conn, address)
+	l.mutex.RLock()
+	peer.SetProofOfWorkCheck(l.powMode, l.powRequired)
+	if l.versions != nil {
+		peer.SetNetworkVersions(*l.versions)
+	}
+	peer.SetOptions(l.options)
+	if l.dialer != nil {
+		peer.SetDialer(l.dialer)
+	}
+	l.mutex.RUnlock()
+	connMessage := NewConnectionMessage(l.connMessage.Port, l.connMessage.Versions, l.connMessage.PublicKey, l.connMessage.ProofOfWorkStamp)
+	if err := peer.InitIncomingContext(l.ctx, connMessage, l.secretKey); err != nil {
+		log.Printf("Incoming handshake with %s failed: %s", conn.RemoteAddr(), err)
+		// The remote is told why it's rejected the same way as octez does
+		var mismatch *VersionMismatchError
+		if errors.As(err, &mismatch) {
+			if err := peer.RejectIncomingContext(l.ctx, mismatch.Motive, nil); err != nil {
+				log.Printf("Nack to %s is not sent: %s", conn.RemoteAddr(), err)
+			}
+		}
+		conn.Close()
+		return
+	}
+	if err := peer.ConnectIncomingContext(l.ctx, peer.options.DisableMempool, peer.options.PrivateNode); err != nil {
+		log.Printf("Incoming handshake with %s failed: %s", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	select {
+	case l.peers <- peer:
+	case <-l.ctx.Done():
+		peer.Close()
+	}
+}
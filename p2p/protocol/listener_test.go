@@ -0,0 +1,197 @@
+package protocol
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func newTestConnectionMessage(t *testing.T, port uint16) (ConnectionMessage, []byte) {
+	publicKey, secretKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := []Version{{Name: "TEZOS_MAINNET", Major: 0, Minor: 1}}
+	return NewConnectionMessage(port, versions, publicKey[:], make([]byte, connectionMessageProofSize)), secretKey[:]
+}
+
+// countingDialer - counts dials and fails all of them.
+type countingDialer struct {
+	dials int32
+}
+
+func (d *countingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	atomic.AddInt32(&d.dials, 1)
+	return nil, errors.New("dialing is disabled")
+}
+
+func TestListenerAcceptsIncomingHandshake(t *testing.T) {
+	listenerMessage, listenerKey := newTestConnectionMessage(t, 0)
+	listener, err := NewListener("127.0.0.1:0", listenerMessage, listenerKey, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	rpcDialer := new(countingDialer)
+	listener.SetDialer(rpcDialer)
+
+	dialerMessage, dialerKey := newTestConnectionMessage(t, 19732)
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outgoing := NewPeer(conn, *listener.Addr().(*net.TCPAddr))
+	outgoing.SetNetworkVersions(DefaultNetworkVersions())
+	defer outgoing.Close()
+
+	if err := outgoing.Init(dialerMessage, dialerKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := outgoing.Connect(true, false); err != nil {
+		t.Fatal(err)
+	}
+	if !outgoing.PrivateNode {
+		t.Errorf("listener metadata is not received")
+	}
+	if expected := (Version{Name: "TEZOS_MAINNET", Major: 0, Minor: 1}); outgoing.NegotiatedVersion == nil || *outgoing.NegotiatedVersion != expected {
+		t.Errorf("%v != %v", outgoing.NegotiatedVersion, expected)
+	}
+
+	incoming := <-listener.Peers()
+	defer incoming.Close()
+
+	expectedID, _ := crypto.CalcPeerID(dialerMessage.PublicKey)
+	if incoming.ID != expectedID {
+		t.Errorf("%s != %s", incoming.ID, expectedID)
+	}
+	if incoming.Address.Port != 19732 {
+		t.Errorf("%d != %d", incoming.Address.Port, 19732)
+	}
+	if !incoming.DisableMempool {
+		t.Errorf("dialer metadata is not received")
+	}
+
+	// Messages go both ways after the handshake
+	go outgoing.SendMessage(BootstrapMsg{})
+	if _, msgType, err := incoming.ReceivePeerMessage(); err != nil || msgType != BootstrapTag {
+		t.Errorf("bootstrap message is not received: %v", err)
+	}
+
+	// RPC of incoming peers is probed through the dialer of the listener
+	if err := incoming.FindRPC(); err == nil {
+		t.Errorf("RPC is found through the failing dialer")
+	}
+	if dials := atomic.LoadInt32(&rpcDialer.dials); dials == 0 {
+		t.Errorf("dialer of the listener isn't used")
+	}
+}
+
+func TestListenerRejectsVersionMismatch(t *testing.T) {
+	listenerMessage, listenerKey := newTestConnectionMessage(t, 0)
+	listener, err := NewListener("127.0.0.1:0", listenerMessage, listenerKey, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.SetNetworkVersions(DefaultNetworkVersions())
+
+	dialerMessage, dialerKey := newTestConnectionMessage(t, 19732)
+	dialerMessage.Versions = []Version{{Name: "TEZOS_ITHACANET", Major: 0, Minor: 1}}
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outgoing := NewPeer(conn, *listener.Addr().(*net.TCPAddr))
+	defer outgoing.Close()
+
+	if err := outgoing.Init(dialerMessage, dialerKey); err != nil {
+		t.Fatal(err)
+	}
+	err = outgoing.Connect(false, false)
+	var nack *NackError
+	if !errors.As(err, &nack) {
+		t.Fatalf("nack is not received: %v", err)
+	}
+	if nack.Motive != NackUnknownChainName {
+		t.Errorf("%s != %s", nack.Motive, NackUnknownChainName)
+	}
+}
+
+func TestListenerCloseInterruptsHandshake(t *testing.T) {
+	listenerMessage, listenerKey := newTestConnectionMessage(t, 0)
+	listener, err := NewListener("127.0.0.1:0", listenerMessage, listenerKey, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.SetOptions(Options{HandshakeTimeout: time.Minute})
+
+	// The remote connects and keeps silence, so the handshake waits for the connection message
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- listener.Close()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waits for the pending handshake")
+	}
+	if _, ok := <-listener.Peers(); ok {
+		t.Errorf("peer is accepted after Close")
+	}
+}
+
+func TestProofOfWorkCheck(t *testing.T) {
+	listenerMessage, listenerKey := newTestConnectionMessage(t, 0)
+	listener, err := NewListener("127.0.0.1:0", listenerMessage, listenerKey, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	tests := []struct {
+		mode    ProofOfWorkMode
+		wantErr bool
+	}{
+		{ProofOfWorkOff, false},
+		{ProofOfWorkRecord, false},
+		{ProofOfWorkEnforce, true},
+	}
+
+	for _, test := range tests {
+		dialerMessage, dialerKey := newTestConnectionMessage(t, 0)
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		peer := NewPeer(conn, *listener.Addr().(*net.TCPAddr))
+		peer.SetProofOfWorkCheck(test.mode, DefaultProofOfWorkDifficulty)
+
+		err = peer.Init(dialerMessage, dialerKey)
+		if _, ok := err.(*ProofOfWorkError); ok != test.wantErr {
+			t.Errorf("mode %d: unexpected error: %v", test.mode, err)
+		}
+
+		expected := crypto.ProofOfWorkDifficulty(listenerMessage.PublicKey, listenerMessage.ProofOfWorkStamp)
+		if test.mode == ProofOfWorkOff {
+			expected = 0
+		}
+		if peer.ProofOfWorkDifficulty != expected {
+			t.Errorf("mode %d: difficulty %f != %f", test.mode, peer.ProofOfWorkDifficulty, expected)
+		}
+		peer.Close()
+	}
+}
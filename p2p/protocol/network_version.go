@@ -0,0 +1,133 @@
+package protocol
+
+import (
+	"fmt"
+	"net"
+)
+
+// NetworkVersions - versions which are supported locally. Version.Major of the connection message is
+// the distributed DB version and Version.Minor is the p2p version.
+type NetworkVersions struct {
+	ChainName             string
+	DistributedDBVersions []uint16
+	P2PVersions           []uint16
+}
+
+// DefaultNetworkVersions - versions supported by current octez releases on mainnet.
+func DefaultNetworkVersions() NetworkVersions {
+	return NetworkVersions{
+		ChainName:             "TEZOS_MAINNET",
+		DistributedDBVersions: []uint16{0, 1, 2},
+		P2PVersions:           []uint16{0, 1},
+	}
+}
+
+// Announce - returns the version which is sent in the connection message: the highest supported one.
+func (versions NetworkVersions) Announce() Version {
+	return Version{
+		Name:  versions.ChainName,
+		Major: maxVersion(versions.DistributedDBVersions),
+		Minor: maxVersion(versions.P2PVersions),
+	}
+}
+
+// Select - chooses the highest version which is supported by both sides the same way as octez does.
+// If the remote announces several versions the best of the acceptable ones is chosen.
+func (versions NetworkVersions) Select(remote []Version) (selected Version, err error) {
+	motive := NackUnknownChainName
+	found := false
+	for _, version := range remote {
+		candidate, candidateMotive := versions.selectOne(version)
+		if candidateMotive != NackNoMotive {
+			if motive == NackUnknownChainName {
+				motive = candidateMotive
+			}
+			continue
+		}
+		if !found || candidate.Major > selected.Major || candidate.Major == selected.Major && candidate.Minor > selected.Minor {
+			selected = candidate
+			found = true
+		}
+	}
+
+	if !found {
+		return selected, &VersionMismatchError{
+			Motive: motive,
+			Local:  versions.Announce(),
+			Remote: remote,
+		}
+	}
+	return selected, nil
+}
+
+func (versions NetworkVersions) selectOne(remote Version) (Version, NackMotive) {
+	if remote.Name != versions.ChainName {
+		return Version{}, NackUnknownChainName
+	}
+	ddbVersion, ok := selectVersion(versions.DistributedDBVersions, remote.Major)
+	if !ok {
+		return Version{}, NackDeprecatedDistributedDBVersion
+	}
+	p2pVersion, ok := selectVersion(versions.P2PVersions, remote.Minor)
+	if !ok {
+		return Version{}, NackDeprecatedP2PVersion
+	}
+	return Version{
+		Name:  versions.ChainName,
+		Major: ddbVersion,
+		Minor: p2pVersion,
+	}, NackNoMotive
+}
+
+// selectVersion - the best local version which isn't newer than the remote one is chosen. Supported versions
+// may have gaps, so it isn't required that the remote version is supported locally.
+func selectVersion(accepted []uint16, remote uint16) (best uint16, ok bool) {
+	for _, version := range accepted {
+		if version <= remote && (!ok || version > best) {
+			best, ok = version, true
+		}
+	}
+	return
+}
+
+func maxVersion(versions []uint16) (max uint16) {
+	for _, version := range versions {
+		if version > max {
+			max = version
+		}
+	}
+	return
+}
+
+// SetNetworkVersions - sets versions which are supported locally. If they are set the common version
+// is negotiated during Init and recorded to NegotiatedVersion.
+func (peer *Peer) SetNetworkVersions(versions NetworkVersions) {
+	peer.versions = &versions
+}
+
+func (peer *Peer) negotiateVersion(received *ConnectionMessage) error {
+	if peer.versions == nil {
+		return nil
+	}
+
+	version, err := peer.versions.Select(received.Versions)
+	if err != nil {
+		err.(*VersionMismatchError).ip = peer.Address.IP
+		return err
+	}
+	peer.NegotiatedVersion = &version
+	return nil
+}
+
+// VersionMismatchError - there is no version which is supported by both sides.
+type VersionMismatchError struct {
+	ip     net.IP
+	Motive NackMotive
+	Local  Version
+	Remote []Version
+}
+
+// Error -
+func (obj *VersionMismatchError) Error() string {
+	return fmt.Sprintf("%s - version mismatch (%s): local %v, remote %v", obj.ip.String(), obj.Motive, obj.Local, obj.Remote)
+}
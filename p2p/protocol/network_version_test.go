@@ -0,0 +1,138 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNetworkVersionsSelect(t *testing.T) {
+	local := DefaultNetworkVersions()
+
+	tests := []struct {
+		name   string
+		remote []Version
+		want   Version
+		motive NackMotive
+	}{
+		{"same", []Version{{"TEZOS_MAINNET", 2, 1}}, Version{"TEZOS_MAINNET", 2, 1}, NackNoMotive},
+		{"newer remote", []Version{{"TEZOS_MAINNET", 5, 3}}, Version{"TEZOS_MAINNET", 2, 1}, NackNoMotive},
+		{"older remote", []Version{{"TEZOS_MAINNET", 0, 0}}, Version{"TEZOS_MAINNET", 0, 0}, NackNoMotive},
+		{"best of several", []Version{{"TEZOS_MAINNET", 0, 0}, {"TEZOS_MAINNET", 1, 1}}, Version{"TEZOS_MAINNET", 1, 1}, NackNoMotive},
+		{"other chain", []Version{{"TEZOS_ITHACANET", 2, 1}}, Version{}, NackUnknownChainName},
+		{"no versions", nil, Version{}, NackUnknownChainName},
+	}
+
+	for _, test := range tests {
+		version, err := local.Select(test.remote)
+		if test.motive == NackNoMotive {
+			if err != nil {
+				t.Errorf("%s: %s", test.name, err)
+			}
+			if version != test.want {
+				t.Errorf("%s: %v != %v", test.name, version, test.want)
+			}
+			continue
+		}
+
+		var mismatch *VersionMismatchError
+		if !errors.As(err, &mismatch) {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if mismatch.Motive != test.motive {
+			t.Errorf("%s: %s != %s", test.name, mismatch.Motive, test.motive)
+		}
+	}
+
+	deprecated := NetworkVersions{
+		ChainName:             "TEZOS_MAINNET",
+		DistributedDBVersions: []uint16{2},
+		P2PVersions:           []uint16{1},
+	}
+	if _, err := deprecated.Select([]Version{{"TEZOS_MAINNET", 1, 1}}); err.(*VersionMismatchError).Motive != NackDeprecatedDistributedDBVersion {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := deprecated.Select([]Version{{"TEZOS_MAINNET", 2, 0}}); err.(*VersionMismatchError).Motive != NackDeprecatedP2PVersion {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestSelectVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		accepted []uint16
+		remote   uint16
+		want     uint16
+		ok       bool
+	}{
+		{"same", []uint16{0, 1, 2}, 2, 2, true},
+		{"newer remote", []uint16{0, 1, 2}, 5, 2, true},
+		{"older remote", []uint16{0, 1, 2}, 1, 1, true},
+		{"gap", []uint16{0, 2}, 1, 0, true},
+		{"gap above lowest", []uint16{1, 3, 4}, 2, 1, true},
+		{"unordered", []uint16{4, 1, 3}, 3, 3, true},
+		{"below lowest", []uint16{1, 2}, 0, 0, false},
+		{"no versions", nil, 1, 0, false},
+	}
+
+	for _, test := range tests {
+		version, ok := selectVersion(test.accepted, test.remote)
+		if version != test.want || ok != test.ok {
+			t.Errorf("%s: %d/%v != %d/%v", test.name, version, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestAckMessageFromBytes(t *testing.T) {
+	tests := []struct {
+		data   []byte
+		isNack bool
+		motive NackMotive
+	}{
+		{[]byte{0x00}, false, NackNoMotive},
+		{[]byte{0xff}, true, NackNoMotive},
+		{[]byte{0x01, 0x00, 0x03}, true, NackDeprecatedP2PVersion},
+		{[]byte{0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}, true, NackTooManyConnections},
+	}
+
+	for _, test := range tests {
+		var ack ackMessage
+		if err := ack.fromBytes(test.data); err != nil {
+			t.Errorf("%x: %s", test.data, err)
+			continue
+		}
+		if ack.IsNack != test.isNack || ack.Motive != test.motive {
+			t.Errorf("%x: %v != %v/%s", test.data, ack, test.isNack, test.motive)
+		}
+	}
+
+	var ack ackMessage
+	if err := ack.fromBytes([]byte{0x01, 0x00}); err == nil {
+		t.Errorf("truncated nack must be rejected")
+	}
+}
+
+func TestNackPoints(t *testing.T) {
+	nack := ackMessage{
+		IsNack: true,
+		Motive: NackTooManyConnections,
+		Points: []string{"10.0.0.1:9732", "[2001:db8::1]:9732"},
+	}
+	data := nack.toBytes()
+	if data[0] != nackTag {
+		t.Errorf("%x != %x", data[0], nackTag)
+	}
+
+	var decoded ackMessage
+	if err := decoded.fromBytes(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, nack) {
+		t.Errorf("%+v != %+v", decoded, nack)
+	}
+
+	if err := decoded.fromBytes([]byte{0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x05, 0x00}); err == nil {
+		t.Errorf("truncated nack points must be rejected")
+	}
+}
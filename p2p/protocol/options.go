@@ -0,0 +1,69 @@
+package protocol
+
+import (
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+// default timeouts
+const (
+	DefaultDialTimeout      = 8 * time.Second
+	DefaultHandshakeTimeout = 6 * time.Second
+	DefaultReadTimeout      = 10 * time.Second
+	DefaultWriteTimeout     = 10 * time.Second
+)
+
+// DefaultRPCPort - default port of the node RPC.
+const DefaultRPCPort = 8732
+
+// Options - timeouts of the connection phases and parameters which are announced to the remote.
+// Zero timeouts are replaced by defaults.
+type Options struct {
+	// DialTimeout - limit of TCP connection establishing. It's applied by the dialing side.
+	DialTimeout time.Duration
+	// HandshakeTimeout - deadline of sending or receiving the connection message.
+	HandshakeTimeout time.Duration
+	// ReadTimeout - deadline of receiving an encrypted message chunk.
+	ReadTimeout time.Duration
+	// WriteTimeout - deadline of sending an encrypted message.
+	WriteTimeout time.Duration
+
+	// ListeningPort - port announced in the connection message. If it's 0 the caller decides which port is announced.
+	ListeningPort uint16
+	// PrivateNode - announces the node as private in metadata, so the remote doesn't advertise it to other peers.
+	PrivateNode bool
+	// DisableMempool - asks the remote not to send mempool operations.
+	DisableMempool bool
+
+	// RPCPort - port which FindRPC checks before the well-known RPC ports. Default is DefaultRPCPort.
+	RPCPort int
+	// ChainID - chain whose head is requested from the peer. Heads of other chains are ignored.
+	// If it's zero, the chain which the remote mentions first is used.
+	ChainID crypto.ChainID
+}
+
+// DefaultOptions -
+func DefaultOptions() Options {
+	return Options{}.WithDefaults()
+}
+
+// WithDefaults - returns options where zero timeouts and RPC port are replaced by defaults.
+func (options Options) WithDefaults() Options {
+	if options.DialTimeout == 0 {
+		options.DialTimeout = DefaultDialTimeout
+	}
+	if options.HandshakeTimeout == 0 {
+		options.HandshakeTimeout = DefaultHandshakeTimeout
+	}
+	if options.ReadTimeout == 0 {
+		options.ReadTimeout = DefaultReadTimeout
+	}
+	if options.WriteTimeout == 0 {
+		options.WriteTimeout = DefaultWriteTimeout
+	}
+	if options.RPCPort == 0 {
+		options.RPCPort = DefaultRPCPort
+	}
+	return options
+}
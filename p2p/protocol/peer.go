@@ -1,11 +1,16 @@
 package protocol
 
 import (
+	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/dialer"
 	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
 )
 
@@ -18,35 +23,50 @@ type Version struct {
 
 type nonceType = []byte
 
-//
 // Peer is a struct for communicating with tezos nodes.
 //
 // There are several basic methods: SendMessage and ReceivePeerMessage.
+// After the handshake Session runs concurrent exchange of messages with the peer.
 // For initialize a Peer object call three methods: New, Init, Connect.
 type Peer struct {
 	conn           net.Conn
 	localNonce     nonceType
 	remoteNonce    nonceType
 	precomputedKey [32]byte
+	received       []byte
+	locator        *BlockLocator
+	powMode        ProofOfWorkMode
+	powRequired    float64
+	versions       *NetworkVersions
+	options        Options
+	rpcClient      *http.Client
+	session        *Session
 
-	ID             string      `json:"id"`
-	Versions       []Version   `json:"versions"`
-	DisableMempool bool        `json:"disable_mempool"`
-	PrivateNode    bool        `json:"private_node"`
-	Address        net.TCPAddr `json:"address"`
-	Synced         bool        `json:"synced"`
-	RPC            bool        `json:"rpc"`
-	Error          error       `json:"error"`
-	Neighbors      []string    `json:"neighbors"`
+	ID                    string            `json:"id"`
+	Versions              []Version         `json:"versions"`
+	DisableMempool        bool              `json:"disable_mempool"`
+	PrivateNode           bool              `json:"private_node"`
+	Address               net.TCPAddr       `json:"address"`
+	Synced                bool              `json:"synced"`
+	RPC                   bool              `json:"rpc"`
+	Error                 error             `json:"error"`
+	Neighbors             []string          `json:"neighbors"`
+	ProofOfWorkDifficulty float64           `json:"proof_of_work_difficulty"`
+	NegotiatedVersion     *Version          `json:"negotiated_version,omitempty"`
+	Head                  *crypto.BlockHash `json:"head,omitempty"`
+	Level                 uint32            `json:"level,omitempty"`
+	Fitness               RawFitness        `json:"fitness,omitempty"`
+	ProtocolData          *ProtocolData     `json:"protocol_data,omitempty"`
 }
 
 // SendMessage -
 func (peer *Peer) SendMessage(message peerMessage) (err error) {
-	err = sendEncryptedMessage(peer.conn, message.toBytes(), peer.localNonce, &peer.precomputedKey)
-	if err != nil {
-		return
-	}
-	peer.localNonce = crypto.NonceIncrement(peer.localNonce)
+	return peer.SendMessageContext(context.Background(), message)
+}
+
+// SendMessageContext - sends the message. Cancellation of the context interrupts sending.
+func (peer *Peer) SendMessageContext(ctx context.Context, message peerMessage) (err error) {
+	peer.localNonce, err = sendEncryptedMessage(ctx, peer.conn, message.toBytes(), peer.localNonce, &peer.precomputedKey, peer.options.WriteTimeout)
 	return
 }
 
@@ -57,20 +77,34 @@ func (peer *Peer) SendMessage(message peerMessage) (err error) {
 msg, msgType, err := peer.ReceivePeerMessage()
 if err == nil {
 	if msgType == CurrentBranchTag {
-		log.Print(msg.(CurrentBranchMsg).Branch)
+		log.Print(msg.(CurrentBranchMsg).Locator.History)
 	}
 }
 */
 func (peer *Peer) ReceivePeerMessage() (msg interface{}, messageType PeerMessageType, err error) {
+	return peer.ReceivePeerMessageContext(context.Background())
+}
+
+// ReceivePeerMessageContext - receives the message. Cancellation of the context interrupts receiving.
+func (peer *Peer) ReceivePeerMessageContext(ctx context.Context) (msg interface{}, messageType PeerMessageType, err error) {
 	messageType = UnknownTag
 	msg = nil
 
-	data, err := peer.receiveData()
+	data, err := peer.receiveData(ctx, peer.options.ReadTimeout)
 	if err != nil {
 		return
 	}
-	msg, messageType = parseMessage(data)
-	return
+	return parseMessage(data)
+}
+
+// receiveIdleMessage - receives the message waiting for its first chunk without timeout, as the peer may be
+// silent for long in established sessions. The rest chunks of the message are received with ReadTimeout.
+func (peer *Peer) receiveIdleMessage(ctx context.Context) (msg interface{}, messageType PeerMessageType, err error) {
+	data, err := peer.receiveData(ctx, 0)
+	if err != nil {
+		return nil, UnknownTag, err
+	}
+	return parseMessage(data)
 }
 
 // NewPeer -
@@ -78,39 +112,96 @@ func NewPeer(conn net.Conn, address net.TCPAddr) (peer *Peer) {
 	peer = new(Peer)
 	peer.conn = conn
 	peer.Address = address
+	peer.options = DefaultOptions()
 	return
 }
 
-// Init -
+// SetDialer - sets the dialer which is used by RPC probes of the peer.
+func (peer *Peer) SetDialer(d dialer.Dialer) {
+	peer.rpcClient = dialer.HTTPClient(d, rpcTimeout)
+}
+
+// SetOptions - sets timeouts of the connection. Zero timeouts are replaced by defaults.
+func (peer *Peer) SetOptions(options Options) {
+	peer.options = options.WithDefaults()
+}
+
+// SetBlockLocator - sets the branch which is sent in reply to GetCurrentBranch.
+// If it isn't set, the peer's own current head is used.
+func (peer *Peer) SetBlockLocator(locator *BlockLocator) {
+	peer.locator = locator
+}
+
+// Init - performs the initiator side of the connection message exchange.
 func (peer *Peer) Init(connMessage ConnectionMessage, secretKey []byte) (err error) {
-	if err = sendConnectionMessage(peer.conn, connMessage); err != nil {
+	return peer.InitContext(context.Background(), connMessage, secretKey)
+}
+
+// InitContext - Init which respects cancellation and deadline of the context.
+func (peer *Peer) InitContext(ctx context.Context, connMessage ConnectionMessage, secretKey []byte) (err error) {
+	if err = sendConnectionMessage(ctx, peer.conn, connMessage, peer.options.HandshakeTimeout); err != nil {
 		return
 	}
 
-	receiveMessage, err := receiveConnectionMessage(peer.conn)
-	if err != nil || receiveMessage == nil {
+	receiveMessage, err := receiveConnectionMessage(ctx, peer.conn, peer.options.HandshakeTimeout)
+	if err != nil {
 		return err
 	}
 
-	peer.localNonce, peer.remoteNonce = crypto.GenerateNonces(connMessage.toBytes(), receiveMessage.toBytes(), false)
-	peer.precomputedKey = crypto.PrecomputeSharedKey(receiveMessage.PublicKey, secretKey)
-	peer.Versions = receiveMessage.Versions
-	peer.ID, err = crypto.CalcPeerID(receiveMessage.PublicKey)
-	return err
+	return peer.initSession(connMessage, receiveMessage, secretKey, false)
+}
+
+// InitIncoming - performs the responder side of the connection message exchange.
+// The peer's address port is replaced by the listening port which the remote announced.
+func (peer *Peer) InitIncoming(connMessage ConnectionMessage, secretKey []byte) (err error) {
+	return peer.InitIncomingContext(context.Background(), connMessage, secretKey)
 }
 
-// Connect -
+// InitIncomingContext - InitIncoming which respects cancellation and deadline of the context.
+func (peer *Peer) InitIncomingContext(ctx context.Context, connMessage ConnectionMessage, secretKey []byte) (err error) {
+	receiveMessage, err := receiveConnectionMessage(ctx, peer.conn, peer.options.HandshakeTimeout)
+	if err != nil {
+		return err
+	}
+
+	if err = sendConnectionMessage(ctx, peer.conn, connMessage, peer.options.HandshakeTimeout); err != nil {
+		return
+	}
+
+	peer.Address.Port = int(receiveMessage.Port)
+	return peer.initSession(connMessage, receiveMessage, secretKey, true)
+}
+
+func (peer *Peer) initSession(sent ConnectionMessage, received *ConnectionMessage, secretKey []byte, incoming bool) (err error) {
+	peer.localNonce, peer.remoteNonce = crypto.GenerateNonces(sent.toBytes(), received.toBytes(), incoming)
+	peer.precomputedKey = crypto.PrecomputeSharedKey(received.PublicKey, secretKey)
+	peer.Versions = received.Versions
+	if peer.ID, err = crypto.CalcPeerID(received.PublicKey); err != nil {
+		return err
+	}
+	if err = peer.negotiateVersion(received); err != nil {
+		return err
+	}
+	return peer.checkProofOfWork(received)
+}
+
+// Connect - performs the initiator side of the metadata and ack exchange.
 func (peer *Peer) Connect(disableMemoryPool bool, privateNode bool) (err error) {
+	return peer.ConnectContext(context.Background(), disableMemoryPool, privateNode)
+}
+
+// ConnectContext - Connect which respects cancellation and deadline of the context.
+func (peer *Peer) ConnectContext(ctx context.Context, disableMemoryPool bool, privateNode bool) (err error) {
 	metaMsg := &metadata{
 		DisableMempool: disableMemoryPool,
 		PrivateNode:    privateNode,
 	}
 
-	if err = peer.SendMessage(metaMsg); err != nil {
+	if err = peer.SendMessageContext(ctx, metaMsg); err != nil {
 		return
 	}
 
-	if err = peer.receiveMeta(); err != nil {
+	if err = peer.receiveMeta(ctx); err != nil {
 		return
 	}
 
@@ -118,17 +209,92 @@ func (peer *Peer) Connect(disableMemoryPool bool, privateNode bool) (err error)
 		IsNack: false,
 	}
 
-	if err = peer.SendMessage(ack); err != nil {
+	if err = peer.SendMessageContext(ctx, ack); err != nil {
 		return
 	}
 
-	if err = peer.receiveAck(); err != nil {
+	if err = peer.receiveAck(ctx); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// ConnectIncoming - performs the responder side of the metadata and ack exchange.
+func (peer *Peer) ConnectIncoming(disableMemoryPool bool, privateNode bool) (err error) {
+	return peer.ConnectIncomingContext(context.Background(), disableMemoryPool, privateNode)
+}
+
+// ConnectIncomingContext - ConnectIncoming which respects cancellation and deadline of the context.
+func (peer *Peer) ConnectIncomingContext(ctx context.Context, disableMemoryPool bool, privateNode bool) (err error) {
+	if err = peer.receiveMeta(ctx); err != nil {
+		return
+	}
+
+	metaMsg := &metadata{
+		DisableMempool: disableMemoryPool,
+		PrivateNode:    privateNode,
+	}
+
+	if err = peer.SendMessageContext(ctx, metaMsg); err != nil {
+		return
+	}
+
+	if err = peer.receiveAck(ctx); err != nil {
+		return err
+	}
+
+	return peer.SendMessageContext(ctx, &ackMessage{
+		IsNack: false,
+	})
+}
+
+// RejectIncoming - performs the responder side of the metadata exchange and rejects the connection by nack.
+// Points are proposed to the remote instead of the peer.
+func (peer *Peer) RejectIncoming(motive NackMotive, points []string) error {
+	return peer.RejectIncomingContext(context.Background(), motive, points)
+}
+
+// RejectIncomingContext - RejectIncoming which respects cancellation and deadline of the context.
+func (peer *Peer) RejectIncomingContext(ctx context.Context, motive NackMotive, points []string) (err error) {
+	if err = peer.receiveMeta(ctx); err != nil {
+		return
+	}
+
+	if err = peer.SendMessageContext(ctx, &metadata{}); err != nil {
+		return
+	}
+
+	if err = peer.receiveAck(ctx); err != nil {
+		return err
+	}
+
+	return peer.SendMessageContext(ctx, &ackMessage{
+		IsNack: true,
+		Motive: motive,
+		Points: points,
+	})
+}
+
+// Session - returns the session of the peer which answers routine requests. The session is started on the first call,
+// after that the peer mustn't be read directly.
+func (peer *Peer) Session() *Session {
+	if peer.session == nil {
+		peer.session = NewSession(peer)
+		peer.session.AnswerRoutineRequests()
+		peer.session.Start()
+	}
+	return peer.session
+}
+
+// Close -
+func (peer *Peer) Close() error {
+	if peer.conn == nil {
+		return nil
+	}
+	return peer.conn.Close()
+}
+
 // String -
 func (peer *Peer) String() string {
 	var jsonData []byte
@@ -139,8 +305,36 @@ func (peer *Peer) String() string {
 	return string(jsonData)
 }
 
-func (peer *Peer) receiveData() (data []byte, err error) {
-	data, err = receiveEncryptedMessage(peer.conn, peer.remoteNonce, &peer.precomputedKey)
+// receiveData - returns the next peer message. A message may be split into several chunks,
+// so chunks are accumulated until the whole message announced by its length prefix is received.
+// The first chunk is awaited for idleTimeout, the next ones for ReadTimeout.
+func (peer *Peer) receiveData(ctx context.Context, idleTimeout time.Duration) (data []byte, err error) {
+	timeout := idleTimeout
+	for {
+		if len(peer.received) >= peerMessageLenSize {
+			length := binary.BigEndian.Uint32(peer.received[:peerMessageLenSize])
+			if length > maxPeerMessageSize {
+				return nil, fmt.Errorf("peer message is too large: %d bytes", length)
+			}
+			size := int(length) + peerMessageLenSize
+			if len(peer.received) >= size {
+				data = append(data, peer.received[:size]...)
+				peer.received = peer.received[size:]
+				return
+			}
+		}
+
+		chunk, err := peer.receiveChunk(ctx, timeout)
+		if err != nil {
+			return nil, err
+		}
+		peer.received = append(peer.received, chunk...)
+		timeout = peer.options.ReadTimeout
+	}
+}
+
+func (peer *Peer) receiveChunk(ctx context.Context, timeout time.Duration) (chunk []byte, err error) {
+	chunk, err = receiveEncryptedMessage(ctx, peer.conn, peer.remoteNonce, &peer.precomputedKey, timeout)
 	if err != nil {
 		return
 	}
@@ -148,8 +342,8 @@ func (peer *Peer) receiveData() (data []byte, err error) {
 	return
 }
 
-func (peer *Peer) receiveMeta() (err error) {
-	meta, err := receiveMetaMessage(peer.conn, peer.remoteNonce, &peer.precomputedKey)
+func (peer *Peer) receiveMeta(ctx context.Context) (err error) {
+	meta, err := receiveMetaMessage(ctx, peer.conn, peer.remoteNonce, &peer.precomputedKey, peer.options.ReadTimeout)
 	if err != nil {
 		return
 	}
@@ -159,42 +353,105 @@ func (peer *Peer) receiveMeta() (err error) {
 	return
 }
 
-func (peer *Peer) receiveAck() (err error) {
-	ack, err := receiveAckMessage(peer.conn, peer.remoteNonce, &peer.precomputedKey)
+func (peer *Peer) receiveAck(ctx context.Context) (err error) {
+	ack, err := receiveAckMessage(ctx, peer.conn, peer.remoteNonce, &peer.precomputedKey, peer.options.ReadTimeout)
 	if err != nil {
 		return
 	}
 	peer.remoteNonce = crypto.NonceIncrement(peer.remoteNonce)
 	if ack.IsNack {
-		err = &NackError{ip: peer.Address.IP}
+		err = &NackError{ip: peer.Address.IP, Motive: ack.Motive, Points: ack.Points}
 	}
 	return
 }
 
+// rpcTimeout - limit of RPC probe requests without deadline of the context.
+const rpcTimeout = 5 * time.Second
+
+// wellKnownRPCPorts - ports of the node RPC which are checked in addition to the configured one.
+var wellKnownRPCPorts = []int{DefaultRPCPort, 18732}
+
+// rpcClient - client of node RPC which is used if the dialer of the peer isn't set.
+var rpcClient = &http.Client{Timeout: rpcTimeout}
+
 // FindRPC -
 func (peer *Peer) FindRPC() error {
-	for _, port := range []string{"8732", "18732"} {
-		host := net.JoinHostPort(peer.Address.IP.String(), port)
+	return peer.FindRPCContext(context.Background())
+}
+
+// FindRPCContext - checks if RPC of the peer is open on the RPC port of the options or on the well-known ports.
+// Unreachable ports are skipped, the error is returned if no port is reachable. Cancellation of the context interrupts requests.
+func (peer *Peer) FindRPCContext(ctx context.Context) error {
+	client := rpcClient
+	if peer.rpcClient != nil {
+		client = peer.rpcClient
+	}
+
+	var (
+		lastErr   error
+		reachable bool
+	)
+	for _, port := range peer.rpcPorts() {
+		host := net.JoinHostPort(peer.Address.IP.String(), strconv.Itoa(port))
 		path := fmt.Sprintf("http://%s/chains/main/blocks/head", host)
-		resp, err := http.Get(path)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
 		if err != nil {
 			return err
 		}
+		resp, err := client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
 		if resp.StatusCode == http.StatusOK {
 			peer.RPC = true
-			break
+			return nil
 		}
+		reachable = true
+	}
+	if reachable {
+		return nil
 	}
+	return lastErr
+}
 
-	return nil
+// rpcPorts - the RPC port of the options followed by the well-known ports without duplicates.
+func (peer *Peer) rpcPorts() []int {
+	ports := make([]int, 0, len(wellKnownRPCPorts)+1)
+	if peer.options.RPCPort != 0 {
+		ports = append(ports, peer.options.RPCPort)
+	}
+	for _, port := range wellKnownRPCPorts {
+		if port != peer.options.RPCPort {
+			ports = append(ports, port)
+		}
+	}
+	return ports
 }
 
-// NackError -
+// NackError - the remote rejected the connection. Points are addresses which the remote proposes to connect instead of it.
 type NackError struct {
-	ip net.IP
+	ip     net.IP
+	Motive NackMotive
+	Points []string
 }
 
 // Error -
 func (obj *NackError) Error() string {
-	return fmt.Sprintf("%s - received nack", obj.ip.String())
+	if obj.Motive.IsVersionMismatch() {
+		return fmt.Sprintf("%s - received nack: version mismatch (%s)", obj.ip.String(), obj.Motive)
+	}
+	if len(obj.Points) > 0 {
+		return fmt.Sprintf("%s - received nack (%s) with %d alternative points", obj.ip.String(), obj.Motive, len(obj.Points))
+	}
+	return fmt.Sprintf("%s - received nack (%s)", obj.ip.String(), obj.Motive)
+}
+
+// IsVersionMismatch - reports whether the remote rejected the connection because of incompatible network versions.
+func (obj *NackError) IsVersionMismatch() bool {
+	return obj.Motive.IsVersionMismatch()
 }
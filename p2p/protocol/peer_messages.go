@@ -2,8 +2,10 @@ package protocol
 
 import (
 	"encoding/binary"
-	"encoding/hex"
-	"log"
+	"fmt"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+	"golang.org/x/crypto/blake2b"
 )
 
 // PeerMessageType -
@@ -11,28 +13,38 @@ type PeerMessageType = uint16
 
 // messgae tags
 const (
-	UnknownTag          PeerMessageType = 0x0
-	AdvertiseTag                        = 0x03
-	GetCurrentBranchTag                 = 0x10
-	CurrentHeadTag                      = 0x14
+	UnknownTag                PeerMessageType = 0x0
+	DisconnectTag                             = 0x01
+	BootstrapTag                              = 0x02
+	AdvertiseTag                              = 0x03
+	SwapRequestTag                            = 0x04
+	SwapAckTag                                = 0x05
+	GetCurrentBranchTag                       = 0x10
+	CurrentBranchTag                          = 0x11
+	DeactivateTag                             = 0x12
+	GetCurrentHeadTag                         = 0x13
+	CurrentHeadTag                            = 0x14
+	GetBlockHeadersTag                        = 0x20
+	BlockHeaderTag                            = 0x21
+	GetOperationsTag                          = 0x30
+	OperationTag                              = 0x31
+	GetProtocolsTag                           = 0x40
+	ProtocolTag                               = 0x41
+	GetOperationsForBlocksTag                 = 0x50
+	OperationsForBlocksTag                    = 0x51
 )
 
 // sizes
 const (
-	peerMessageLenSize       = 4
-	peerMessageTypeSize      = 2
-	peerMessageStringLenSize = 4
-	chainIDLen               = 4
-	blockHeaderSize          = 4
-	levelSize                = 4
-	byteSize                 = 1
-	predecessorSize          = 32
-	timestampSize            = 8
-	operationHashSize        = 32
-	fitnessBlockSize         = 4
-	contextSize              = 32
+	maxPeerMessageSize  = 16 * 1024 * 1024
+	peerMessageLenSize  = 4
+	peerMessageTypeSize = 2
 )
 
+// DisconnectMsg -
+type DisconnectMsg struct {
+}
+
 // BootstrapMsg -
 type BootstrapMsg struct {
 }
@@ -42,191 +54,724 @@ type AdvertiseMsg struct {
 	Addresses []string
 }
 
+// SwapRequestMsg -
+type SwapRequestMsg struct {
+	Point  string
+	PeerID crypto.PeerID
+}
+
+// SwapAckMsg -
+type SwapAckMsg struct {
+	Point  string
+	PeerID crypto.PeerID
+}
+
 // GetCurrentBranchMsg -
 type GetCurrentBranchMsg struct {
-	Branch string
+	ChainID crypto.ChainID
+}
+
+// BlockLocator - current head of a chain and hashes of its predecessors from the newest to the oldest.
+type BlockLocator struct {
+	CurrentHead BlockHeader
+	History     []crypto.BlockHash
+}
+
+// CurrentBranchMsg -
+type CurrentBranchMsg struct {
+	ChainID crypto.ChainID
+	Locator BlockLocator
+}
+
+// DeactivateMsg -
+type DeactivateMsg struct {
+	ChainID crypto.ChainID
 }
 
 // GetCurrentHeadMsg -
 type GetCurrentHeadMsg struct {
-	ChainID string
+	ChainID crypto.ChainID
 }
 
-type byteSlice = []byte
-
-// BlockHeader -
-type BlockHeader struct {
-	Level          uint32
-	Proto          byte
-	Predecessor    []byte
-	Timestamp      int64
-	ValidationPass byte
-	OperationHash  []byte
-	Fitness        []byteSlice
-	Context        []byte
-	ProtocolData   []byte
+// Mempool - operation hashes which are known by a peer.
+type Mempool struct {
+	KnownValid []crypto.OperationHash
+	Pending    []crypto.OperationHash
 }
 
 // CurrentHeadMsg -
 type CurrentHeadMsg struct {
-	ChainID            string
+	ChainID            crypto.ChainID
 	CurrentBlockHeader BlockHeader
+	Mempool            Mempool
+}
+
+// GetBlockHeadersMsg -
+type GetBlockHeadersMsg struct {
+	Hashes []crypto.BlockHash
+}
+
+// BlockHeaderMsg -
+type BlockHeaderMsg struct {
+	Header BlockHeader
+}
+
+// GetOperationsMsg -
+type GetOperationsMsg struct {
+	Hashes []crypto.OperationHash
+}
+
+// Operation - shell header (branch) and protocol specific data of an operation.
+type Operation struct {
+	Branch crypto.BlockHash
+	Data   []byte
+}
+
+// OperationMsg -
+type OperationMsg struct {
+	Operation Operation
+}
+
+// GetProtocolsMsg -
+type GetProtocolsMsg struct {
+	Hashes []crypto.ProtocolHash
+}
+
+// ProtocolComponent -
+type ProtocolComponent struct {
+	Name           string
+	Interface      *string
+	Implementation string
+}
+
+// Protocol -
+type Protocol struct {
+	ExpectedEnvVersion uint16
+	Components         []ProtocolComponent
+}
+
+// ProtocolMsg -
+type ProtocolMsg struct {
+	Protocol Protocol
+}
+
+// OperationsForBlock - block hash and validation pass which operations are requested.
+type OperationsForBlock struct {
+	Hash           crypto.BlockHash
+	ValidationPass int8
+}
+
+// GetOperationsForBlocksMsg -
+type GetOperationsForBlocksMsg struct {
+	Blocks []OperationsForBlock
+}
+
+// PathStep - one step of a merkle path from the root to an operation list.
+// Left is true if the path goes to the left subtree. Hash is the hash of the sibling subtree.
+type PathStep struct {
+	Left bool
+	Hash crypto.OperationListListHash
+}
+
+// OperationsForBlocksMsg -
+type OperationsForBlocksMsg struct {
+	Block      OperationsForBlock
+	Path       []PathStep
+	Operations []Operation
+}
+
+// merkle path tags
+const (
+	pathLeftTag  = 0xf0
+	pathRightTag = 0x0f
+	pathOpTag    = 0x00
+)
+
+func (DisconnectMsg) toBytes() []byte {
+	return encodeMessage(DisconnectTag, nil)
 }
 
 func (BootstrapMsg) toBytes() []byte {
 	// "000000020002"
-	data := []byte{0, 0, 0, 2, 0, 2}
-	return data
+	return encodeMessage(BootstrapTag, nil)
 }
 
-func (msg CurrentHeadMsg) toBytes() []byte {
-	bytes := make([]byte, peerMessageLenSize+peerMessageTypeSize+chainIDLen+blockHeaderSize+levelSize+byteSize+
-		predecessorSize+timestampSize+byteSize+operationHashSize+fitnessBlockSize+contextSize)
+func (msg AdvertiseMsg) toBytes() []byte {
+	return encodeMessage(AdvertiseTag, func(e *encoder) {
+		for _, address := range msg.Addresses {
+			e.string(address)
+		}
+	})
+}
 
-	offset := 0
-	binary.BigEndian.PutUint32(bytes[offset:offset+peerMessageLenSize], 124)
-	offset += peerMessageLenSize
+func (msg SwapRequestMsg) toBytes() []byte {
+	return encodeMessage(SwapRequestTag, func(e *encoder) {
+		e.string(msg.Point)
+		e.bytes(msg.PeerID[:])
+	})
+}
 
-	binary.BigEndian.PutUint16(bytes[offset:offset+peerMessageTypeSize], 17)
-	offset += peerMessageTypeSize
+func (msg SwapAckMsg) toBytes() []byte {
+	return encodeMessage(SwapAckTag, func(e *encoder) {
+		e.string(msg.Point)
+		e.bytes(msg.PeerID[:])
+	})
+}
 
-	chainID, err := hex.DecodeString(msg.ChainID)
-	if err != nil {
-		log.Println("serialize error: ", err)
-		return bytes
-	}
-	copy(bytes[offset:offset+chainIDLen], chainID)
-	offset += chainIDLen
+func (msg GetCurrentBranchMsg) toBytes() []byte {
+	return encodeMessage(GetCurrentBranchTag, func(e *encoder) {
+		e.bytes(msg.ChainID[:])
+	})
+}
 
-	binary.BigEndian.PutUint32(bytes[offset:offset+blockHeaderSize], 114)
-	offset += blockHeaderSize
+func (msg CurrentBranchMsg) toBytes() []byte {
+	return encodeMessage(CurrentBranchTag, func(e *encoder) {
+		e.bytes(msg.ChainID[:])
+		e.dynamic(msg.Locator.CurrentHead.encode)
+		encodeHashes(e, msg.Locator.History)
+	})
+}
 
-	return bytes
+func (msg DeactivateMsg) toBytes() []byte {
+	return encodeMessage(DeactivateTag, func(e *encoder) {
+		e.bytes(msg.ChainID[:])
+	})
 }
 
 func (branch GetCurrentHeadMsg) toBytes() []byte {
-	b, _ := hex.DecodeString(branch.ChainID)
-	size := len(b)
-	bytes := make([]byte, peerMessageLenSize+peerMessageTypeSize+size)
+	return encodeMessage(GetCurrentHeadTag, func(e *encoder) {
+		e.bytes(branch.ChainID[:])
+	})
+}
+
+func (msg CurrentHeadMsg) toBytes() []byte {
+	return encodeMessage(CurrentHeadTag, func(e *encoder) {
+		e.bytes(msg.ChainID[:])
+		e.dynamic(msg.CurrentBlockHeader.encode)
+		e.dynamic(func(e *encoder) {
+			encodeHashes(e, msg.Mempool.KnownValid)
+		})
+		e.dynamic(func(e *encoder) {
+			e.dynamic(func(e *encoder) {
+				encodeHashes(e, msg.Mempool.Pending)
+			})
+		})
+	})
+}
+
+func (msg GetBlockHeadersMsg) toBytes() []byte {
+	return encodeMessage(GetBlockHeadersTag, func(e *encoder) {
+		e.dynamic(func(e *encoder) {
+			encodeHashes(e, msg.Hashes)
+		})
+	})
+}
+
+func (msg BlockHeaderMsg) toBytes() []byte {
+	return encodeMessage(BlockHeaderTag, msg.Header.encode)
+}
+
+func (msg GetOperationsMsg) toBytes() []byte {
+	return encodeMessage(GetOperationsTag, func(e *encoder) {
+		e.dynamic(func(e *encoder) {
+			encodeHashes(e, msg.Hashes)
+		})
+	})
+}
+
+// Bytes - encodes the operation.
+func (operation Operation) Bytes() []byte {
+	e := new(encoder)
+	operation.encode(e)
+	return e.data
+}
+
+// Hash - returns operation hash which is blake2b-256 of the encoded operation.
+func (operation Operation) Hash() crypto.OperationHash {
+	return blake2b.Sum256(operation.Bytes())
+}
+
+func (operation Operation) encode(e *encoder) {
+	e.bytes(operation.Branch[:])
+	e.bytes(operation.Data)
+}
+
+func (msg OperationMsg) toBytes() []byte {
+	return encodeMessage(OperationTag, msg.Operation.encode)
+}
 
-	index := 0
-	binary.BigEndian.PutUint32(bytes[:peerMessageLenSize], uint32(size+2))
-	index += peerMessageLenSize
+func (msg GetProtocolsMsg) toBytes() []byte {
+	return encodeMessage(GetProtocolsTag, func(e *encoder) {
+		e.dynamic(func(e *encoder) {
+			encodeHashes(e, msg.Hashes)
+		})
+	})
+}
 
-	// тэг для запроса currentHead
-	copy(bytes[index:index+peerMessageTypeSize], []byte{0, 19})
-	index += peerMessageTypeSize
+func (msg ProtocolMsg) toBytes() []byte {
+	return encodeMessage(ProtocolTag, func(e *encoder) {
+		e.uint16(msg.Protocol.ExpectedEnvVersion)
+		e.dynamic(func(e *encoder) {
+			for _, component := range msg.Protocol.Components {
+				e.string(component.Name)
+				e.bool(component.Interface != nil)
+				if component.Interface != nil {
+					e.string(*component.Interface)
+				}
+				e.string(component.Implementation)
+			}
+		})
+	})
+}
 
-	copy(bytes[index:index+size], b)
-	return bytes
+func (block OperationsForBlock) encode(e *encoder) {
+	e.bytes(block.Hash[:])
+	e.uint8(byte(block.ValidationPass))
 }
 
-func parseString(data []byte) (str string, offset uint32) {
-	offset = 0
-	length := binary.BigEndian.Uint32(data[offset : offset+peerMessageStringLenSize])
-	offset += peerMessageStringLenSize
+func (msg GetOperationsForBlocksMsg) toBytes() []byte {
+	return encodeMessage(GetOperationsForBlocksTag, func(e *encoder) {
+		e.dynamic(func(e *encoder) {
+			for _, block := range msg.Blocks {
+				block.encode(e)
+			}
+		})
+	})
+}
 
-	str = string(data[offset : offset+length])
-	offset += length
+func encodePath(e *encoder, path []PathStep) {
+	if len(path) == 0 {
+		e.uint8(pathOpTag)
+		return
+	}
+	if path[0].Left {
+		e.uint8(pathLeftTag)
+		encodePath(e, path[1:])
+		e.bytes(path[0].Hash[:])
+	} else {
+		e.uint8(pathRightTag)
+		e.bytes(path[0].Hash[:])
+		encodePath(e, path[1:])
+	}
+}
+
+func (msg OperationsForBlocksMsg) toBytes() []byte {
+	return encodeMessage(OperationsForBlocksTag, func(e *encoder) {
+		msg.Block.encode(e)
+		encodePath(e, msg.Path)
+		e.dynamic(func(e *encoder) {
+			for _, operation := range msg.Operations {
+				e.dynamic(operation.encode)
+			}
+		})
+	})
+}
+
+func parseString(data []byte) (str string, offset uint32, err error) {
+	d := newDecoder(data)
+	if str, err = d.string(); err != nil {
+		return
+	}
+	offset = uint32(d.offset)
 	return
 }
 
-func newAdvertiseMsg(data []byte, messageLen uint32) (message AdvertiseMsg) {
+func newAdvertiseMsg(data []byte) (message AdvertiseMsg, err error) {
 	var offset uint32 = 0
-	for offset+peerMessageLenSize+peerMessageTypeSize < messageLen {
-		str, off := parseString(data[offset:])
+	for offset < uint32(len(data)) {
+		str, off, err := parseString(data[offset:])
+		if err != nil {
+			return message, fmt.Errorf("invalid advertised address: %s", err)
+		}
 		message.Addresses = append(message.Addresses, str)
 		offset += off
 	}
 	return
 }
 
-func newGetCurrentBranchMsg(data []byte) (message GetCurrentBranchMsg) {
-	message.Branch = hex.EncodeToString(data)
+func newSwapMsg(data []byte) (point string, peerID crypto.PeerID, err error) {
+	d := newDecoder(data)
+	if point, err = d.string(); err != nil {
+		return
+	}
+	if err = d.hash(peerID[:]); err != nil {
+		return
+	}
+	if d.remaining() != 0 {
+		err = fmt.Errorf("%d unexpected bytes after swap message", d.remaining())
+	}
+	return
+}
+
+func newSwapRequestMsg(data []byte) (message SwapRequestMsg, err error) {
+	message.Point, message.PeerID, err = newSwapMsg(data)
+	return
+}
+
+func newSwapAckMsg(data []byte) (message SwapAckMsg, err error) {
+	message.Point, message.PeerID, err = newSwapMsg(data)
+	return
+}
+
+func newGetCurrentBranchMsg(data []byte) (message GetCurrentBranchMsg, err error) {
+	message.ChainID, err = newChainIDMsg(data)
+	return
+}
+
+func newChainIDMsg(data []byte) (chainID crypto.ChainID, err error) {
+	d := newDecoder(data)
+	if err = d.hash(chainID[:]); err != nil {
+		return
+	}
+	if d.remaining() != 0 {
+		err = fmt.Errorf("%d unexpected bytes after chain ID", d.remaining())
+	}
+	return
+}
+
+func newCurrentBranchMsg(data []byte) (message CurrentBranchMsg, err error) {
+	d := newDecoder(data)
+	if err = d.hash(message.ChainID[:]); err != nil {
+		return
+	}
+	header, err := d.dynamic()
+	if err != nil {
+		return
+	}
+	if message.Locator.CurrentHead, err = decodeBlockHeader(header); err != nil {
+		return
+	}
+	message.Locator.History, err = decodeHashes[crypto.BlockHash](d)
+	return
+}
+
+func newDeactivateMsg(data []byte) (message DeactivateMsg, err error) {
+	message.ChainID, err = newChainIDMsg(data)
+	return
+}
+
+func newGetCurrentHeadMsg(data []byte) (message GetCurrentHeadMsg, err error) {
+	message.ChainID, err = newChainIDMsg(data)
+	return
+}
+
+func newMempool(d *decoder) (mempool Mempool, err error) {
+	knownValid, err := d.dynamic()
+	if err != nil {
+		return
+	}
+	if mempool.KnownValid, err = decodeHashes[crypto.OperationHash](knownValid); err != nil {
+		return
+	}
+	// pending is a dynamic_size set of hashes, so it has two size prefixes
+	pendingSet, err := d.dynamic()
+	if err != nil {
+		return
+	}
+	pending, err := pendingSet.dynamic()
+	if err != nil {
+		return
+	}
+	mempool.Pending, err = decodeHashes[crypto.OperationHash](pending)
 	return
 }
 
 // NewCurrentHeadMsg -
-func NewCurrentHeadMsg(data []byte) (message CurrentHeadMsg) {
-	offset := 0
+func NewCurrentHeadMsg(data []byte) (message CurrentHeadMsg, err error) {
+	d := newDecoder(data)
+	if err = d.hash(message.ChainID[:]); err != nil {
+		return message, fmt.Errorf("invalid chain ID: %s", err)
+	}
 
-	message.ChainID = hex.EncodeToString(data[offset : offset+chainIDLen])
-	offset += chainIDLen
+	header, err := d.dynamic()
+	if err != nil {
+		return message, fmt.Errorf("invalid block header: %s", err)
+	}
+	if message.CurrentBlockHeader, err = decodeBlockHeader(header); err != nil {
+		return message, fmt.Errorf("invalid block header: %s", err)
+	}
 
-	sizeBlockHeader := binary.BigEndian.Uint32(data[offset : offset+blockHeaderSize])
-	offset += blockHeaderSize
+	if message.Mempool, err = newMempool(d); err != nil {
+		return message, fmt.Errorf("invalid mempool: %s", err)
+	}
+	if d.remaining() != 0 {
+		err = fmt.Errorf("%d unexpected bytes after mempool", d.remaining())
+	}
+	return
+}
 
-	message.CurrentBlockHeader.Level = binary.BigEndian.Uint32(data[offset : offset+levelSize])
-	offset += levelSize
+func newHashList(data []byte) (*decoder, error) {
+	d := newDecoder(data)
+	list, err := d.dynamic()
+	if err != nil {
+		return nil, err
+	}
+	if d.remaining() != 0 {
+		return nil, fmt.Errorf("%d unexpected bytes after hash list", d.remaining())
+	}
+	return list, nil
+}
 
-	message.CurrentBlockHeader.Proto = data[offset]
-	offset += byteSize
+func newGetBlockHeadersMsg(data []byte) (message GetBlockHeadersMsg, err error) {
+	list, err := newHashList(data)
+	if err != nil {
+		return
+	}
+	message.Hashes, err = decodeHashes[crypto.BlockHash](list)
+	return
+}
 
-	message.CurrentBlockHeader.Predecessor = append(message.CurrentBlockHeader.Predecessor, data[offset:offset+predecessorSize]...)
-	offset += predecessorSize
+func newBlockHeaderMsg(data []byte) (message BlockHeaderMsg, err error) {
+	message.Header, err = decodeBlockHeader(newDecoder(data))
+	return
+}
 
-	message.CurrentBlockHeader.Timestamp = int64(binary.BigEndian.Uint64(data[offset : offset+timestampSize]))
-	offset += timestampSize
+func newGetOperationsMsg(data []byte) (message GetOperationsMsg, err error) {
+	list, err := newHashList(data)
+	if err != nil {
+		return
+	}
+	message.Hashes, err = decodeHashes[crypto.OperationHash](list)
+	return
+}
 
-	message.CurrentBlockHeader.ValidationPass = data[offset]
-	offset += byteSize
+func decodeOperation(d *decoder) (operation Operation, err error) {
+	if err = d.hash(operation.Branch[:]); err != nil {
+		return
+	}
+	operation.Data = d.rest()
+	return
+}
 
-	message.CurrentBlockHeader.OperationHash = append(message.CurrentBlockHeader.OperationHash, data[offset:offset+operationHashSize]...)
-	offset += operationHashSize
+func newOperationMsg(data []byte) (message OperationMsg, err error) {
+	message.Operation, err = decodeOperation(newDecoder(data))
+	return
+}
 
-	sizeFitnessBlock := binary.BigEndian.Uint32(data[offset : offset+fitnessBlockSize])
-	offset += fitnessBlockSize
+func newGetProtocolsMsg(data []byte) (message GetProtocolsMsg, err error) {
+	list, err := newHashList(data)
+	if err != nil {
+		return
+	}
+	message.Hashes, err = decodeHashes[crypto.ProtocolHash](list)
+	return
+}
 
-	if sizeFitnessBlock != 0 {
-		for sizeFitnessBlock != 0 {
-			sizeFitness := binary.BigEndian.Uint32(data[offset : offset+4])
-			offset += 4
-			sizeFitnessBlock -= 4
-			fitness := make([]byte, sizeFitness)
-			fitness = data[offset : offset+int(sizeFitness)]
-			offset += int(sizeFitness)
-			sizeFitnessBlock -= sizeFitness
-			message.CurrentBlockHeader.Fitness = append(message.CurrentBlockHeader.Fitness, fitness)
+func decodeProtocolComponent(d *decoder) (component ProtocolComponent, err error) {
+	if component.Name, err = d.string(); err != nil {
+		return
+	}
+	hasInterface, err := d.bool()
+	if err != nil {
+		return
+	}
+	if hasInterface {
+		value, err := d.string()
+		if err != nil {
+			return component, err
 		}
+		component.Interface = &value
 	}
+	component.Implementation, err = d.string()
+	return
+}
 
-	message.CurrentBlockHeader.Context = append(message.CurrentBlockHeader.Context, data[offset:offset+contextSize]...)
-	offset += contextSize
+func newProtocolMsg(data []byte) (message ProtocolMsg, err error) {
+	d := newDecoder(data)
+	if message.Protocol.ExpectedEnvVersion, err = d.uint16(); err != nil {
+		return
+	}
+	components, err := d.dynamic()
+	if err != nil {
+		return
+	}
+	for components.remaining() > 0 {
+		component, err := decodeProtocolComponent(components)
+		if err != nil {
+			return message, err
+		}
+		message.Protocol.Components = append(message.Protocol.Components, component)
+	}
+	if d.remaining() != 0 {
+		err = fmt.Errorf("%d unexpected bytes after protocol", d.remaining())
+	}
+	return
+}
+
+func decodeOperationsForBlock(d *decoder) (block OperationsForBlock, err error) {
+	if err = d.hash(block.Hash[:]); err != nil {
+		return
+	}
+	validationPass, err := d.uint8()
+	block.ValidationPass = int8(validationPass)
+	return
+}
+
+func newGetOperationsForBlocksMsg(data []byte) (message GetOperationsForBlocksMsg, err error) {
+	d := newDecoder(data)
+	blocks, err := d.dynamic()
+	if err != nil {
+		return
+	}
+	for blocks.remaining() > 0 {
+		block, err := decodeOperationsForBlock(blocks)
+		if err != nil {
+			return message, err
+		}
+		message.Blocks = append(message.Blocks, block)
+	}
+	if d.remaining() != 0 {
+		err = fmt.Errorf("%d unexpected bytes after block list", d.remaining())
+	}
+	return
+}
 
-	message.CurrentBlockHeader.ProtocolData = append(message.CurrentBlockHeader.ProtocolData, data[offset:sizeBlockHeader+8]...)
+func decodePath(d *decoder) (path []PathStep, err error) {
+	// Left steps store their sibling hash after the nested path, so they are completed on the way back.
+	var pendingLeft []int
+	for {
+		tag, err := d.uint8()
+		if err != nil {
+			return nil, err
+		}
 
+		switch tag {
+		case pathLeftTag:
+			pendingLeft = append(pendingLeft, len(path))
+			path = append(path, PathStep{Left: true})
+		case pathRightTag:
+			var step PathStep
+			if err := d.hash(step.Hash[:]); err != nil {
+				return nil, err
+			}
+			path = append(path, step)
+		case pathOpTag:
+			for i := len(pendingLeft) - 1; i >= 0; i-- {
+				if err := d.hash(path[pendingLeft[i]].Hash[:]); err != nil {
+					return nil, err
+				}
+			}
+			return path, nil
+		default:
+			return nil, fmt.Errorf("unknown merkle path tag: %d", tag)
+		}
+	}
+}
+
+func newOperationsForBlocksMsg(data []byte) (message OperationsForBlocksMsg, err error) {
+	d := newDecoder(data)
+	if message.Block, err = decodeOperationsForBlock(d); err != nil {
+		return
+	}
+	if message.Path, err = decodePath(d); err != nil {
+		return
+	}
+	operations, err := d.dynamic()
+	if err != nil {
+		return
+	}
+	for operations.remaining() > 0 {
+		operation, err := operations.dynamic()
+		if err != nil {
+			return message, err
+		}
+		decoded, err := decodeOperation(operation)
+		if err != nil {
+			return message, err
+		}
+		message.Operations = append(message.Operations, decoded)
+	}
+	if d.remaining() != 0 {
+		err = fmt.Errorf("%d unexpected bytes after operations", d.remaining())
+	}
 	return
 }
 
-func parseMessage(data []byte) (obj interface{}, messageType PeerMessageType) {
+func parseMessage(data []byte) (obj interface{}, messageType PeerMessageType, err error) {
 	obj = nil
 	messageType = UnknownTag
 
-	if len(data) < peerMessageLenSize {
-		return
+	if len(data) < peerMessageLenSize+peerMessageTypeSize {
+		return nil, UnknownTag, fmt.Errorf("peer message is too short: %d bytes", len(data))
 	}
 
 	var offset uint32 = 0
 	length := binary.BigEndian.Uint32(data[offset : offset+peerMessageLenSize])
 	offset += peerMessageLenSize
 
-	if length+peerMessageLenSize != uint32(len(data)) {
-		return
+	if uint64(length)+peerMessageLenSize != uint64(len(data)) {
+		return nil, UnknownTag, fmt.Errorf("peer message length %d doesn't match %d received bytes", length, len(data)-peerMessageLenSize)
 	}
 
 	messageType = binary.BigEndian.Uint16(data[offset : offset+peerMessageTypeSize])
 	offset += peerMessageTypeSize
 
+	body := data[offset:]
 	switch messageType {
-	case GetCurrentBranchTag:
-		obj = newGetCurrentBranchMsg(data[offset : offset+length-peerMessageTypeSize])
+	case DisconnectTag:
+		obj, err = DisconnectMsg{}, checkEmptyBody(body)
+
+	case BootstrapTag:
+		obj, err = BootstrapMsg{}, checkEmptyBody(body)
 
 	case AdvertiseTag:
-		obj = newAdvertiseMsg(data[offset:offset+length-peerMessageTypeSize], length)
+		obj, err = newAdvertiseMsg(body)
+
+	case SwapRequestTag:
+		obj, err = newSwapRequestMsg(body)
+
+	case SwapAckTag:
+		obj, err = newSwapAckMsg(body)
+
+	case GetCurrentBranchTag:
+		obj, err = newGetCurrentBranchMsg(body)
+
+	case CurrentBranchTag:
+		obj, err = newCurrentBranchMsg(body)
+
+	case DeactivateTag:
+		obj, err = newDeactivateMsg(body)
+
+	case GetCurrentHeadTag:
+		obj, err = newGetCurrentHeadMsg(body)
 
 	case CurrentHeadTag:
-		obj = NewCurrentHeadMsg(data[offset : offset+length-peerMessageTypeSize])
+		obj, err = NewCurrentHeadMsg(body)
+
+	case GetBlockHeadersTag:
+		obj, err = newGetBlockHeadersMsg(body)
+
+	case BlockHeaderTag:
+		obj, err = newBlockHeaderMsg(body)
+
+	case GetOperationsTag:
+		obj, err = newGetOperationsMsg(body)
+
+	case OperationTag:
+		obj, err = newOperationMsg(body)
+
+	case GetProtocolsTag:
+		obj, err = newGetProtocolsMsg(body)
+
+	case ProtocolTag:
+		obj, err = newProtocolMsg(body)
+
+	case GetOperationsForBlocksTag:
+		obj, err = newGetOperationsForBlocksMsg(body)
+
+	case OperationsForBlocksTag:
+		obj, err = newOperationsForBlocksMsg(body)
 	}
 
+	if err != nil {
+		return nil, UnknownTag, fmt.Errorf("invalid message with tag 0x%02x: %s", messageType, err)
+	}
 	return
 }
+
+func checkEmptyBody(body []byte) error {
+	if len(body) != 0 {
+		return fmt.Errorf("%d unexpected bytes in message without body", len(body))
+	}
+	return nil
+}
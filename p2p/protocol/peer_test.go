@@ -0,0 +1,63 @@
+package protocol
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// closedPort - returns the port which nobody listens on.
+func closedPort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return port
+}
+
+func TestFindRPC(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chains/main/blocks/head" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	serverPort := server.Listener.Addr().(*net.TCPAddr).Port
+
+	defaultPorts := wellKnownRPCPorts
+	defer func() {
+		wellKnownRPCPorts = defaultPorts
+	}()
+
+	tests := []struct {
+		name      string
+		rpcPort   int
+		ports     []int
+		rpc       bool
+		wantError bool
+	}{
+		{name: "configured port", rpcPort: serverPort, ports: []int{closedPort(t)}, rpc: true},
+		{name: "failed port is skipped", rpcPort: closedPort(t), ports: []int{closedPort(t), serverPort}, rpc: true},
+		{name: "no reachable ports", rpcPort: closedPort(t), ports: []int{closedPort(t)}, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wellKnownRPCPorts = tt.ports
+
+			peer := &Peer{Address: net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+			peer.SetOptions(Options{RPCPort: tt.rpcPort})
+			err := peer.FindRPCContext(context.Background())
+			if (err != nil) != tt.wantError {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if peer.RPC != tt.rpc {
+				t.Errorf("%v != %v", peer.RPC, tt.rpc)
+			}
+		})
+	}
+}
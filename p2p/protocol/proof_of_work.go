@@ -0,0 +1,55 @@
+package protocol
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+// ProofOfWorkMode - how the remote proof-of-work stamp is verified during handshake.
+type ProofOfWorkMode int
+
+// proof-of-work modes
+const (
+	ProofOfWorkOff     ProofOfWorkMode = iota // stamp isn't checked
+	ProofOfWorkRecord                         // achieved difficulty is recorded to the Peer
+	ProofOfWorkEnforce                        // achieved difficulty is recorded and peers below the required one are rejected
+)
+
+// DefaultProofOfWorkDifficulty - difficulty which octez nodes require by default.
+const DefaultProofOfWorkDifficulty = 26.
+
+// ProofOfWorkError -
+type ProofOfWorkError struct {
+	ip         net.IP
+	Difficulty float64
+	Required   float64
+}
+
+// Error -
+func (obj *ProofOfWorkError) Error() string {
+	return fmt.Sprintf("%s - proof of work difficulty %.2f is less than required %.2f", obj.ip.String(), obj.Difficulty, obj.Required)
+}
+
+// SetProofOfWorkCheck - sets how the remote proof-of-work stamp is verified during Init.
+func (peer *Peer) SetProofOfWorkCheck(mode ProofOfWorkMode, difficulty float64) {
+	peer.powMode = mode
+	peer.powRequired = difficulty
+}
+
+func (peer *Peer) checkProofOfWork(message *ConnectionMessage) error {
+	if peer.powMode == ProofOfWorkOff {
+		return nil
+	}
+
+	peer.ProofOfWorkDifficulty = crypto.ProofOfWorkDifficulty(message.PublicKey, message.ProofOfWorkStamp)
+	if peer.powMode == ProofOfWorkEnforce && !crypto.CheckProofOfWork(message.PublicKey, message.ProofOfWorkStamp, peer.powRequired) {
+		return &ProofOfWorkError{
+			ip:         peer.Address.IP,
+			Difficulty: peer.ProofOfWorkDifficulty,
+			Required:   peer.powRequired,
+		}
+	}
+	return nil
+}
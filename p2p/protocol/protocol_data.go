@@ -0,0 +1,199 @@
+package protocol
+
+import (
+	"fmt"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+// ProtocolDataLayout - encoding of the protocol data which differs between protocol families.
+type ProtocolDataLayout int
+
+// protocol data layouts
+const (
+	// ProtocolDataUnknown - genesis and unknown protocols, protocol data is not decoded.
+	ProtocolDataUnknown ProtocolDataLayout = iota
+	// ProtocolDataEmmy - priority, proof-of-work nonce, seed nonce hash and signature (001-009).
+	ProtocolDataEmmy
+	// ProtocolDataEmmyEscapeVote - emmy with liquidity baking escape vote (010-011).
+	ProtocolDataEmmyEscapeVote
+	// ProtocolDataTenderbakeEscapeVote - payload hash and round with liquidity baking escape vote (012).
+	ProtocolDataTenderbakeEscapeVote
+	// ProtocolDataTenderbakeToggleVote - liquidity baking toggle vote (013-017).
+	ProtocolDataTenderbakeToggleVote
+	// ProtocolDataTenderbakePerBlockVotes - liquidity baking and adaptive issuance votes packed to one byte (018+).
+	ProtocolDataTenderbakePerBlockVotes
+)
+
+// String -
+func (layout ProtocolDataLayout) String() string {
+	switch layout {
+	case ProtocolDataEmmy:
+		return "emmy"
+	case ProtocolDataEmmyEscapeVote:
+		return "emmy_escape_vote"
+	case ProtocolDataTenderbakeEscapeVote:
+		return "tenderbake_escape_vote"
+	case ProtocolDataTenderbakeToggleVote:
+		return "tenderbake_toggle_vote"
+	case ProtocolDataTenderbakePerBlockVotes:
+		return "tenderbake_per_block_votes"
+	default:
+		return "unknown"
+	}
+}
+
+// ProtocolDataLayoutOf - returns layout of protocol data by proto level of the block header.
+// Proto levels are counted on mainnet: 1-9 are emmy protocols, 10 is Granada, 12 is Ithaca,
+// 13 is Jakarta and 18 is Oxford. Networks with other proto levels should call DecodeProtocolDataAs.
+func ProtocolDataLayoutOf(proto byte) ProtocolDataLayout {
+	switch {
+	case proto == 0:
+		return ProtocolDataUnknown
+	case proto < 10:
+		return ProtocolDataEmmy
+	case proto < 12:
+		return ProtocolDataEmmyEscapeVote
+	case proto == 12:
+		return ProtocolDataTenderbakeEscapeVote
+	case proto < 18:
+		return ProtocolDataTenderbakeToggleVote
+	default:
+		return ProtocolDataTenderbakePerBlockVotes
+	}
+}
+
+// Vote - value of the per block toggle votes.
+type Vote uint8
+
+// votes
+const (
+	VoteOn   Vote = 0x00
+	VoteOff  Vote = 0x01
+	VotePass Vote = 0x02
+)
+
+// String -
+func (vote Vote) String() string {
+	switch vote {
+	case VoteOn:
+		return "on"
+	case VoteOff:
+		return "off"
+	case VotePass:
+		return "pass"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(vote))
+	}
+}
+
+// MarshalText -
+func (vote Vote) MarshalText() ([]byte, error) {
+	return []byte(vote.String()), nil
+}
+
+// ProtocolData - decoded protocol data of block header. Priority is set for emmy protocols only,
+// payload hash and round are set for tenderbake protocols only. Liquidity baking escape vote
+// is reported as toggle vote: escape is VoteOff, otherwise VoteOn.
+type ProtocolData struct {
+	Layout               ProtocolDataLayout  `json:"-"`
+	Priority             uint16              `json:"priority,omitempty"`
+	PayloadHash          *crypto.PayloadHash `json:"payload_hash,omitempty"`
+	PayloadRound         int32               `json:"payload_round"`
+	ProofOfWorkNonce     byteSlice           `json:"proof_of_work_nonce"`
+	SeedNonceHash        *crypto.NonceHash   `json:"seed_nonce_hash,omitempty"`
+	LiquidityBakingVote  *Vote               `json:"liquidity_baking_toggle_vote,omitempty"`
+	AdaptiveIssuanceVote *Vote               `json:"adaptive_issuance_vote,omitempty"`
+	Signature            crypto.Signature    `json:"signature"`
+}
+
+const proofOfWorkNonceSize = 8
+
+// DecodeProtocolData - decodes protocol data with the layout chosen by proto level of the header.
+func (header BlockHeader) DecodeProtocolData() (ProtocolData, error) {
+	return header.DecodeProtocolDataAs(ProtocolDataLayoutOf(header.Proto))
+}
+
+// DecodeProtocolDataAs - decodes protocol data with the given layout.
+func (header BlockHeader) DecodeProtocolDataAs(layout ProtocolDataLayout) (data ProtocolData, err error) {
+	data.Layout = layout
+	d := newDecoder(header.ProtocolData)
+
+	switch layout {
+	case ProtocolDataEmmy, ProtocolDataEmmyEscapeVote:
+		if data.Priority, err = d.uint16(); err != nil {
+			return
+		}
+	case ProtocolDataTenderbakeEscapeVote, ProtocolDataTenderbakeToggleVote, ProtocolDataTenderbakePerBlockVotes:
+		var payloadHash crypto.PayloadHash
+		if err = d.hash(payloadHash[:]); err != nil {
+			return
+		}
+		data.PayloadHash = &payloadHash
+
+		round, err := d.uint32()
+		if err != nil {
+			return data, err
+		}
+		data.PayloadRound = int32(round)
+	default:
+		return data, fmt.Errorf("unknown protocol data layout of proto %d", header.Proto)
+	}
+
+	if data.ProofOfWorkNonce, err = d.fixed(proofOfWorkNonceSize); err != nil {
+		return
+	}
+
+	hasSeedNonceHash, err := d.bool()
+	if err != nil {
+		return
+	}
+	if hasSeedNonceHash {
+		var seedNonceHash crypto.NonceHash
+		if err = d.hash(seedNonceHash[:]); err != nil {
+			return
+		}
+		data.SeedNonceHash = &seedNonceHash
+	}
+
+	switch layout {
+	case ProtocolDataEmmyEscapeVote, ProtocolDataTenderbakeEscapeVote:
+		escape, err := d.bool()
+		if err != nil {
+			return data, err
+		}
+		vote := VoteOn
+		if escape {
+			vote = VoteOff
+		}
+		data.LiquidityBakingVote = &vote
+	case ProtocolDataTenderbakeToggleVote:
+		value, err := d.uint8()
+		if err != nil {
+			return data, err
+		}
+		vote := Vote(value)
+		if vote > VotePass {
+			return data, fmt.Errorf("invalid liquidity baking toggle vote: %d", value)
+		}
+		data.LiquidityBakingVote = &vote
+	case ProtocolDataTenderbakePerBlockVotes:
+		value, err := d.uint8()
+		if err != nil {
+			return data, err
+		}
+		liquidityBaking, adaptiveIssuance := Vote(value&0x03), Vote((value>>2)&0x03)
+		if liquidityBaking > VotePass || adaptiveIssuance > VotePass {
+			return data, fmt.Errorf("invalid per block votes: %d", value)
+		}
+		data.LiquidityBakingVote = &liquidityBaking
+		data.AdaptiveIssuanceVote = &adaptiveIssuance
+	}
+
+	signature := d.rest()
+	if len(signature) != crypto.SignatureSize && len(signature) != crypto.BLSSignatureSize {
+		return data, fmt.Errorf("invalid signature length: %d", len(signature))
+	}
+	data.Signature = signature
+	return
+}
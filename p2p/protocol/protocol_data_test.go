@@ -0,0 +1,145 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+func testProtocolData(layout ProtocolDataLayout, vote byte, signatureSize int) []byte {
+	e := new(encoder)
+	switch layout {
+	case ProtocolDataEmmy, ProtocolDataEmmyEscapeVote:
+		e.uint16(3)
+	default:
+		e.bytes(bytes.Repeat([]byte{0x11}, 32))
+		e.uint32(2)
+	}
+	e.bytes([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	e.bool(true)
+	e.bytes(bytes.Repeat([]byte{0x22}, 32))
+	if layout != ProtocolDataEmmy {
+		e.uint8(vote)
+	}
+	e.bytes(bytes.Repeat([]byte{0x33}, signatureSize))
+	return e.data
+}
+
+func TestProtocolDataLayoutOf(t *testing.T) {
+	tests := []struct {
+		proto byte
+		want  ProtocolDataLayout
+	}{
+		{0, ProtocolDataUnknown},
+		{1, ProtocolDataEmmy},
+		{9, ProtocolDataEmmy},
+		{10, ProtocolDataEmmyEscapeVote},
+		{11, ProtocolDataEmmyEscapeVote},
+		{12, ProtocolDataTenderbakeEscapeVote},
+		{13, ProtocolDataTenderbakeToggleVote},
+		{17, ProtocolDataTenderbakeToggleVote},
+		{18, ProtocolDataTenderbakePerBlockVotes},
+		{22, ProtocolDataTenderbakePerBlockVotes},
+	}
+	for _, tt := range tests {
+		if got := ProtocolDataLayoutOf(tt.proto); got != tt.want {
+			t.Errorf("%d: %s != %s", tt.proto, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeProtocolData(t *testing.T) {
+	tests := []struct {
+		name                 string
+		proto                byte
+		vote                 byte
+		signatureSize        int
+		liquidityBakingVote  string
+		adaptiveIssuanceVote string
+		wantErr              bool
+	}{
+		{name: "emmy", proto: 5, signatureSize: 64},
+		{name: "granada escape", proto: 10, vote: 0xff, signatureSize: 64, liquidityBakingVote: "off"},
+		{name: "ithaca no escape", proto: 12, vote: 0x00, signatureSize: 64, liquidityBakingVote: "on"},
+		{name: "jakarta pass", proto: 13, vote: 0x02, signatureSize: 64, liquidityBakingVote: "pass"},
+		{name: "jakarta invalid vote", proto: 13, vote: 0x03, signatureSize: 64, wantErr: true},
+		{name: "oxford", proto: 18, vote: 0x06, signatureSize: 64, liquidityBakingVote: "pass", adaptiveIssuanceVote: "off"},
+		{name: "oxford bls", proto: 20, vote: 0x00, signatureSize: 96, liquidityBakingVote: "on", adaptiveIssuanceVote: "on"},
+		{name: "short signature", proto: 18, signatureSize: 10, wantErr: true},
+		{name: "genesis", proto: 0, signatureSize: 64, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := BlockHeader{
+				Proto:        tt.proto,
+				ProtocolData: testProtocolData(ProtocolDataLayoutOf(tt.proto), tt.vote, tt.signatureSize),
+			}
+			data, err := header.DecodeProtocolData()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeProtocolData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if data.Layout == ProtocolDataEmmy || data.Layout == ProtocolDataEmmyEscapeVote {
+				if data.Priority != 3 || data.PayloadHash != nil {
+					t.Errorf("invalid emmy fields: %d %v", data.Priority, data.PayloadHash)
+				}
+			} else {
+				if data.PayloadHash == nil || data.PayloadHash[0] != 0x11 || data.PayloadRound != 2 {
+					t.Errorf("invalid tenderbake fields: %v %d", data.PayloadHash, data.PayloadRound)
+				}
+			}
+			if hex.EncodeToString(data.ProofOfWorkNonce) != "0102030405060708" {
+				t.Errorf("%x != 0102030405060708", data.ProofOfWorkNonce)
+			}
+			if data.SeedNonceHash == nil || data.SeedNonceHash[31] != 0x22 {
+				t.Errorf("invalid seed nonce hash: %v", data.SeedNonceHash)
+			}
+			if len(data.Signature) != tt.signatureSize {
+				t.Errorf("%d != %d", len(data.Signature), tt.signatureSize)
+			}
+
+			var liquidityBakingVote, adaptiveIssuanceVote string
+			if data.LiquidityBakingVote != nil {
+				liquidityBakingVote = data.LiquidityBakingVote.String()
+			}
+			if data.AdaptiveIssuanceVote != nil {
+				adaptiveIssuanceVote = data.AdaptiveIssuanceVote.String()
+			}
+			if liquidityBakingVote != tt.liquidityBakingVote {
+				t.Errorf("%s != %s", liquidityBakingVote, tt.liquidityBakingVote)
+			}
+			if adaptiveIssuanceVote != tt.adaptiveIssuanceVote {
+				t.Errorf("%s != %s", adaptiveIssuanceVote, tt.adaptiveIssuanceVote)
+			}
+		})
+	}
+}
+
+func TestDecodeProtocolDataWithoutSeedNonceHash(t *testing.T) {
+	e := new(encoder)
+	e.bytes(make([]byte, 32))
+	e.uint32(0)
+	e.bytes(make([]byte, 8))
+	e.bool(false)
+	e.uint8(0)
+	e.bytes(make([]byte, 64))
+
+	data, err := BlockHeader{Proto: 18, ProtocolData: e.data}.DecodeProtocolData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.SeedNonceHash != nil {
+		t.Errorf("unexpected seed nonce hash: %s", data.SeedNonceHash)
+	}
+	if sig := data.Signature.String(); sig[:3] != "sig" {
+		t.Errorf("%s has no sig prefix", sig)
+	}
+	if _, err := crypto.ParseSignature(data.Signature.String()); err != nil {
+		t.Error(err)
+	}
+}
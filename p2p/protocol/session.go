@@ -0,0 +1,434 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
+)
+
+// DefaultRequestTimeout - how long the awaitable requests of the peer wait for the reply.
+const DefaultRequestTimeout = 10 * time.Second
+
+// session errors
+var (
+	ErrSessionClosed = errors.New("session is closed")
+	ErrDisconnected  = errors.New("remote has disconnected")
+)
+
+// Handler - handles the received message. Handlers are called from the reader goroutine one by one,
+// so they must not await other messages. Returned error closes the session.
+type Handler func(session *Session, msg interface{}) error
+
+// Matcher - reports whether the received message is the awaited one.
+type Matcher func(msg interface{}, msgType PeerMessageType) bool
+
+// Session - concurrent session with the peer. The reader goroutine receives messages, delivers them to awaiting
+// requests and to handlers registered per message tag. The writer goroutine sends messages in order of posting.
+// When the session is started, the peer mustn't be read or written directly.
+type Session struct {
+	peer *Peer
+
+	mutex    sync.Mutex
+	handlers map[PeerMessageType][]Handler
+	waiters  map[*waiter]struct{}
+	started  bool
+
+	chainID    crypto.ChainID
+	chainKnown chan struct{}
+	heads      map[crypto.ChainID]CurrentHeadMsg
+	branches   map[crypto.ChainID]struct{}
+	swapPoints []string
+
+	outgoing  chan outgoingMessage
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+type waiter struct {
+	match  Matcher
+	result chan interface{}
+}
+
+type outgoingMessage struct {
+	message peerMessage
+	result  chan error
+}
+
+// NewSession - creates session around the handshaked peer. Handlers should be registered before Start.
+func NewSession(peer *Peer) *Session {
+	return &Session{
+		peer:     peer,
+		handlers: make(map[PeerMessageType][]Handler),
+		waiters:  make(map[*waiter]struct{}),
+		outgoing: make(chan outgoingMessage, 16),
+		done:     make(chan struct{}),
+
+		chainKnown: make(chan struct{}),
+		heads:      make(map[crypto.ChainID]CurrentHeadMsg),
+		branches:   make(map[crypto.ChainID]struct{}),
+	}
+}
+
+// Peer -
+func (session *Session) Peer() *Peer {
+	return session.peer
+}
+
+// Start - starts reader and writer goroutines. Repeated calls do nothing.
+func (session *Session) Start() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.started {
+		return
+	}
+	session.started = true
+	go session.read()
+	go session.write()
+}
+
+// Handle - registers the handler of messages with the tag. Several handlers of one tag are called in order of registration.
+func (session *Session) Handle(tag PeerMessageType, handler Handler) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.handlers[tag] = append(session.handlers[tag], handler)
+}
+
+// HandleMessage - registers the typed handler of messages with the tag.
+func HandleMessage[T any](session *Session, tag PeerMessageType, handler func(session *Session, msg T) error) {
+	session.Handle(tag, func(session *Session, msg interface{}) error {
+		typed, ok := msg.(T)
+		if !ok {
+			return fmt.Errorf("unexpected message type of tag 0x%02x: %T", tag, msg)
+		}
+		return handler(session, typed)
+	})
+}
+
+// Send - sends the message and waits until it's written.
+func (session *Session) Send(message peerMessage) error {
+	return session.SendContext(context.Background(), message)
+}
+
+// SendContext - sends the message and waits until it's written or the context is done.
+// The message which is already queued is sent anyway.
+func (session *Session) SendContext(ctx context.Context, message peerMessage) error {
+	result := make(chan error, 1)
+	select {
+	case session.outgoing <- outgoingMessage{message, result}:
+	case <-session.done:
+		return session.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-session.done:
+		return session.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Post - queues the message without waiting. It's safe to call from handlers.
+func (session *Session) Post(message peerMessage) {
+	select {
+	case session.outgoing <- outgoingMessage{message: message}:
+	case <-session.done:
+	}
+}
+
+// Await - waits for the first message which is received after the call and matches.
+func (session *Session) Await(match Matcher, timeout time.Duration) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return session.AwaitContext(ctx, match)
+}
+
+// AwaitContext - waits for the first message which is received after the call and matches until the context is done.
+func (session *Session) AwaitContext(ctx context.Context, match Matcher) (interface{}, error) {
+	return session.wait(ctx, session.subscribe(match))
+}
+
+// Request - sends the request and waits for the matching reply.
+func (session *Session) Request(request peerMessage, match Matcher, timeout time.Duration) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return session.RequestContext(ctx, request, match)
+}
+
+// RequestContext - sends the request and waits for the matching reply until the context is done.
+func (session *Session) RequestContext(ctx context.Context, request peerMessage, match Matcher) (interface{}, error) {
+	w := session.subscribe(match)
+	if err := session.SendContext(ctx, request); err != nil {
+		session.unsubscribe(w)
+		return nil, err
+	}
+	return session.wait(ctx, w)
+}
+
+// GetCurrentHead - requests the current head of the chain.
+func (session *Session) GetCurrentHead(chainID crypto.ChainID, timeout time.Duration) (head CurrentHeadMsg, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return session.GetCurrentHeadContext(ctx, chainID)
+}
+
+// GetCurrentHeadContext - requests the current head of the chain until the context is done.
+func (session *Session) GetCurrentHeadContext(ctx context.Context, chainID crypto.ChainID) (head CurrentHeadMsg, err error) {
+	msg, err := session.RequestContext(ctx, GetCurrentHeadMsg{ChainID: chainID}, MatchCurrentHead(chainID))
+	if err != nil {
+		return head, fmt.Errorf("current head of chain %s is not received: %w", chainID, err)
+	}
+	return msg.(CurrentHeadMsg), nil
+}
+
+// ChainID - returns the chain which the remote has mentioned first or waits until it's mentioned.
+func (session *Session) ChainID(timeout time.Duration) (crypto.ChainID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return session.ChainIDContext(ctx)
+}
+
+// ChainIDContext - returns the chain which the remote has mentioned first or waits until it's mentioned or the context is done.
+func (session *Session) ChainIDContext(ctx context.Context) (crypto.ChainID, error) {
+	select {
+	case <-session.chainKnown:
+		return session.chainID, nil
+	case <-session.done:
+		return crypto.ChainID{}, session.Err()
+	case <-ctx.Done():
+		return crypto.ChainID{}, fmt.Errorf("%s - chain is unknown: %w", session.peer.Address.IP.String(), ctx.Err())
+	}
+}
+
+// SwapPoints - returns points which the remote has proposed in swap messages.
+func (session *Session) SwapPoints() []string {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	return append([]string(nil), session.swapPoints...)
+}
+
+// Done - is closed when the session is over.
+func (session *Session) Done() <-chan struct{} {
+	return session.done
+}
+
+// Err - returns the reason why the session is over.
+func (session *Session) Err() error {
+	select {
+	case <-session.done:
+		return session.err
+	default:
+		return nil
+	}
+}
+
+// Close - closes the session and the peer connection.
+func (session *Session) Close() error {
+	session.close(ErrSessionClosed)
+	return nil
+}
+
+func (session *Session) close(err error) {
+	session.closeOnce.Do(func() {
+		session.err = err
+		close(session.done)
+		session.peer.Close()
+	})
+}
+
+func (session *Session) subscribe(match Matcher) *waiter {
+	w := &waiter{
+		match:  match,
+		result: make(chan interface{}, 1),
+	}
+	session.mutex.Lock()
+	session.waiters[w] = struct{}{}
+	session.mutex.Unlock()
+	return w
+}
+
+func (session *Session) unsubscribe(w *waiter) {
+	session.mutex.Lock()
+	delete(session.waiters, w)
+	session.mutex.Unlock()
+}
+
+func (session *Session) wait(ctx context.Context, w *waiter) (interface{}, error) {
+	defer session.unsubscribe(w)
+
+	select {
+	case msg := <-w.result:
+		return msg, nil
+	case <-session.done:
+		return nil, session.Err()
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s - reply is not received: %w", session.peer.Address.IP.String(), ctx.Err())
+	}
+}
+
+// read - receives messages until the session is closed. The peer may be idle for long, so there is no read timeout:
+// Close closes the connection and unblocks the reader.
+func (session *Session) read() {
+	for {
+		msg, msgType, err := session.peer.receiveIdleMessage(context.Background())
+		if err != nil {
+			session.close(err)
+			return
+		}
+		if err := session.dispatch(msg, msgType); err != nil {
+			session.close(err)
+			return
+		}
+	}
+}
+
+func (session *Session) dispatch(msg interface{}, msgType PeerMessageType) error {
+	session.mutex.Lock()
+	for w := range session.waiters {
+		if w.match(msg, msgType) {
+			w.result <- msg
+			delete(session.waiters, w)
+		}
+	}
+	handlers := session.handlers[msgType]
+	session.mutex.Unlock()
+
+	for _, handler := range handlers {
+		if err := handler(session, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (session *Session) write() {
+	for {
+		select {
+		case out := <-session.outgoing:
+			err := session.peer.SendMessage(out.message)
+			if out.result != nil {
+				out.result <- err
+			}
+			if err != nil {
+				session.close(err)
+				return
+			}
+		case <-session.done:
+			return
+		}
+	}
+}
+
+// MatchTag - matches any message with the tag.
+func MatchTag(tag PeerMessageType) Matcher {
+	return func(_ interface{}, msgType PeerMessageType) bool {
+		return msgType == tag
+	}
+}
+
+// MatchCurrentHead - matches CurrentHead of the chain.
+func MatchCurrentHead(chainID crypto.ChainID) Matcher {
+	return func(msg interface{}, msgType PeerMessageType) bool {
+		head, ok := msg.(CurrentHeadMsg)
+		return ok && msgType == CurrentHeadTag && head.ChainID == chainID
+	}
+}
+
+// AnswerRoutineRequests - registers handlers which answer routine requests of the remote: GetCurrentBranch
+// is answered by the block locator or by the remote's own head when it's received, GetCurrentHead is answered
+// when the block locator is set and Bootstrap is answered by empty Advertise. Chain ID mentioned by the remote is recorded.
+// Swap requests are declined by silence and their points are recorded. Disconnect closes the session with ErrDisconnected.
+func (session *Session) AnswerRoutineRequests() {
+	HandleMessage(session, GetCurrentBranchTag, func(session *Session, msg GetCurrentBranchMsg) error {
+		session.learnChain(msg.ChainID)
+		if branch, ok := session.currentBranch(msg.ChainID); ok {
+			session.Post(branch)
+			return nil
+		}
+		session.mutex.Lock()
+		session.branches[msg.ChainID] = struct{}{}
+		session.mutex.Unlock()
+		return nil
+	})
+	HandleMessage(session, CurrentBranchTag, func(session *Session, msg CurrentBranchMsg) error {
+		session.learnChain(msg.ChainID)
+		return nil
+	})
+	HandleMessage(session, GetCurrentHeadTag, func(session *Session, msg GetCurrentHeadMsg) error {
+		session.learnChain(msg.ChainID)
+		if locator := session.peer.locator; locator != nil {
+			session.Post(CurrentHeadMsg{
+				ChainID:            msg.ChainID,
+				CurrentBlockHeader: locator.CurrentHead,
+			})
+		}
+		return nil
+	})
+	HandleMessage(session, CurrentHeadTag, func(session *Session, msg CurrentHeadMsg) error {
+		session.learnChain(msg.ChainID)
+		session.mutex.Lock()
+		session.heads[msg.ChainID] = msg
+		_, pending := session.branches[msg.ChainID]
+		delete(session.branches, msg.ChainID)
+		session.mutex.Unlock()
+
+		if pending {
+			session.Post(session.peer.currentBranch(msg.ChainID, msg))
+		}
+		return nil
+	})
+	session.Handle(BootstrapTag, func(session *Session, _ interface{}) error {
+		session.Post(AdvertiseMsg{})
+		return nil
+	})
+	HandleMessage(session, SwapRequestTag, func(session *Session, msg SwapRequestMsg) error {
+		session.addSwapPoint(msg.Point)
+		return nil
+	})
+	HandleMessage(session, SwapAckTag, func(session *Session, msg SwapAckMsg) error {
+		session.addSwapPoint(msg.Point)
+		return nil
+	})
+	session.Handle(DisconnectTag, func(session *Session, _ interface{}) error {
+		return ErrDisconnected
+	})
+}
+
+func (session *Session) addSwapPoint(point string) {
+	session.mutex.Lock()
+	session.swapPoints = append(session.swapPoints, point)
+	session.mutex.Unlock()
+}
+
+func (session *Session) learnChain(chainID crypto.ChainID) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	select {
+	case <-session.chainKnown:
+	default:
+		session.chainID = chainID
+		close(session.chainKnown)
+	}
+}
+
+func (session *Session) currentBranch(chainID crypto.ChainID) (CurrentBranchMsg, bool) {
+	if session.peer.locator != nil {
+		return session.peer.currentBranch(chainID, CurrentHeadMsg{}), true
+	}
+	session.mutex.Lock()
+	head, ok := session.heads[chainID]
+	session.mutex.Unlock()
+	if !ok {
+		return CurrentBranchMsg{}, false
+	}
+	return session.peer.currentBranch(chainID, head), true
+}
@@ -0,0 +1,174 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetPeersAddressesSkipsInterleavedMessages(t *testing.T) {
+	local, remote := newPipePeers()
+	defer local.Close()
+	defer remote.Close()
+
+	addresses := []string{"10.0.0.1:9732", "10.0.0.2:9732"}
+	errs := make(chan error, 1)
+	go func() {
+		if _, msgType, err := remote.ReceivePeerMessage(); err != nil || msgType != BootstrapTag {
+			errs <- errors.New("bootstrap is not received")
+			return
+		}
+		for _, msg := range []peerMessage{
+			GetCurrentBranchMsg{ChainID: testChainID},
+			CurrentHeadMsg{ChainID: testChainID, CurrentBlockHeader: testBlockHeader()},
+			AdvertiseMsg{Addresses: addresses},
+		} {
+			if err := remote.SendMessage(msg); err != nil {
+				errs <- err
+				return
+			}
+		}
+		// the branch request is answered as soon as the head is received
+		if _, msgType, err := remote.ReceivePeerMessage(); err != nil || msgType != CurrentBranchTag {
+			errs <- errors.New("current branch is not received")
+			return
+		}
+		errs <- nil
+	}()
+
+	neighbors, err := local.GetPeersAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(local.Neighbors, addresses) {
+		t.Errorf("%v != %v", local.Neighbors, addresses)
+	}
+	if len(neighbors) != len(addresses) {
+		t.Errorf("%d != %d", len(neighbors), len(addresses))
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	chainID, err := local.Session().ChainID(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chainID != testChainID {
+		t.Errorf("%s != %s", chainID, testChainID)
+	}
+}
+
+func TestSessionHandlers(t *testing.T) {
+	local, remote := newPipePeers()
+	defer remote.Close()
+
+	session := NewSession(local)
+	received := make(chan DeactivateMsg, 1)
+	HandleMessage(session, DeactivateTag, func(session *Session, msg DeactivateMsg) error {
+		received <- msg
+		return nil
+	})
+	failure := errors.New("handler failure")
+	session.Handle(DisconnectTag, func(session *Session, _ interface{}) error {
+		return failure
+	})
+	session.Start()
+
+	if err := remote.SendMessage(DeactivateMsg{ChainID: testChainID}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-received; msg.ChainID != testChainID {
+		t.Errorf("%s != %s", msg.ChainID, testChainID)
+	}
+
+	if err := remote.SendMessage(DisconnectMsg{}); err != nil {
+		t.Fatal(err)
+	}
+	<-session.Done()
+	if session.Err() != failure {
+		t.Errorf("%v != %v", session.Err(), failure)
+	}
+	if err := session.Send(BootstrapMsg{}); err != failure {
+		t.Errorf("%v != %v", err, failure)
+	}
+}
+
+func TestSessionRequestTimeout(t *testing.T) {
+	local, remote := newPipePeers()
+	defer remote.Close()
+
+	session := NewSession(local)
+	session.Start()
+	defer session.Close()
+
+	go remote.ReceivePeerMessage()
+
+	if _, err := session.Request(GetCurrentHeadMsg{ChainID: testChainID}, MatchCurrentHead(testChainID), 50*time.Millisecond); err == nil {
+		t.Errorf("request without reply succeeded")
+	}
+
+	session.Close()
+	if _, err := session.Await(MatchTag(CurrentHeadTag), time.Second); err != ErrSessionClosed {
+		t.Errorf("%v != %v", err, ErrSessionClosed)
+	}
+}
+
+func TestSessionSwapAndDisconnect(t *testing.T) {
+	local, remote := newPipePeers()
+	defer remote.Close()
+
+	session := local.Session()
+	for _, msg := range []peerMessage{
+		SwapRequestMsg{Point: "10.0.0.1:9732", PeerID: testPeerID(1)},
+		SwapAckMsg{Point: "10.0.0.2:9732", PeerID: testPeerID(2)},
+		DisconnectMsg{},
+	} {
+		if err := remote.SendMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	<-session.Done()
+	if session.Err() != ErrDisconnected {
+		t.Errorf("%v != %v", session.Err(), ErrDisconnected)
+	}
+	if points := session.SwapPoints(); !reflect.DeepEqual(points, []string{"10.0.0.1:9732", "10.0.0.2:9732"}) {
+		t.Errorf("invalid swap points: %v", points)
+	}
+	if peers := PeersFromPoints(session.SwapPoints()); len(peers) != 2 || peers[1].Address.Port != 9732 {
+		t.Errorf("invalid peers: %v", peers)
+	}
+}
+
+func TestSessionIdleLongerThanReadTimeout(t *testing.T) {
+	local, remote := newPipePeers()
+	defer remote.Close()
+
+	options := DefaultOptions()
+	options.ReadTimeout = 50 * time.Millisecond
+	local.SetOptions(options)
+
+	session := NewSession(local)
+	received := make(chan GetCurrentHeadMsg, 1)
+	HandleMessage(session, GetCurrentHeadTag, func(session *Session, msg GetCurrentHeadMsg) error {
+		received <- msg
+		return nil
+	})
+	session.Start()
+	defer session.Close()
+
+	select {
+	case <-session.Done():
+		t.Fatalf("idle session is closed: %v", session.Err())
+	case <-time.After(4 * options.ReadTimeout):
+	}
+
+	if err := remote.SendMessage(GetCurrentHeadMsg{ChainID: testChainID}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-received; msg.ChainID != testChainID {
+		t.Errorf("%s != %s", msg.ChainID, testChainID)
+	}
+}
@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"encoding/binary"
+	"fmt"
 )
 
 const (
@@ -41,36 +42,27 @@ func versionsToBytes(versions []Version) (allBytes []byte) {
 	return allBytes
 }
 
-func newVersion(bytes []byte) (version Version, offset uint32) {
-
-	size := binary.BigEndian.Uint32(bytes[offset : offset+nameLenSize])
-	if size == 0 {
-		return Version{}, 0
+func newVersion(d *decoder) (version Version, err error) {
+	if version.Name, err = d.string(); err != nil {
+		return
 	}
-
-	offset += nameLenSize
-
-	version.Name = string(bytes[offset : offset+size])
-	offset += size
-
-	version.Major = binary.BigEndian.Uint16(bytes[offset : offset+partVersionSize])
-	offset += partVersionSize
-
-	version.Minor = binary.BigEndian.Uint16(bytes[offset : offset+partVersionSize])
-	offset += partVersionSize
-
+	if version.Major, err = d.uint16(); err != nil {
+		return
+	}
+	version.Minor, err = d.uint16()
 	return
 }
 
-func bytesToVersions(bytes []byte) (versions []Version) {
-	index := 0
-	for index != len(bytes) {
-		version, size := newVersion(bytes[index:])
-		if size == 0 {
+func bytesToVersions(bytes []byte) (versions []Version, err error) {
+	d := newDecoder(bytes)
+	for d.remaining() > 0 {
+		version, err := newVersion(d)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version: %s", err)
+		}
+		if version.Name == "" {
 			break
 		}
-
-		index += int(size)
 		versions = append(versions, version)
 	}
 
@@ -1,18 +1,24 @@
 package p2p
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"sync"
 	"time"
 
-	"github.com/aopoltorzhicky/tezos-scanner/p2p/ffi"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/dialer"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/identity"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/networks"
 	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol/crypto"
 )
 
 // Scanner -
 type Scanner struct {
+	network   networks.Network
 	bootstrap []net.IP
 
 	result     chan *protocol.Peer
@@ -23,19 +29,31 @@ type Scanner struct {
 	threadsCount int64
 	syncedTime   int64
 
-	stopped bool
+	stopOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
 
 	attemptsDuration time.Duration
-	identity         ffi.Identity
+	identity         identity.Identity
+	locator          *protocol.BlockLocator
+	listenPort       int
+	listener         *protocol.Listener
+	powMode          protocol.ProofOfWorkMode
+	powRequired      float64
+	versions         protocol.NetworkVersions
+	options          protocol.Options
+	dialer           dialer.Dialer
 
 	proofedPeers sync.Map
+	queued       map[string]struct{}
 	mutex        sync.Mutex
 	wg           sync.WaitGroup
+	incoming     sync.WaitGroup
 }
 
-// IsStopped -
+// IsStopped - returns true if scanning isn't started or is stopped.
 func (scanner *Scanner) IsStopped() bool {
-	return scanner.stopped
+	return scanner.ctx == nil || scanner.ctx.Err() != nil
 }
 
 func prepareBootstrap(bootstrap []string) ([]net.IP, error) {
@@ -52,8 +70,20 @@ func prepareBootstrap(bootstrap []string) ([]net.IP, error) {
 	return ips, nil
 }
 
-// NewScanner -
-func NewScanner(bootstrap []string, identity ffi.Identity, opts ...ScannerOption) (*Scanner, error) {
+// NewScanner - creates scanner of the network. If bootstrap is empty, the network's default bootstrap hosts are used.
+func NewScanner(network networks.Network, bootstrap []string, provider identity.Provider, opts ...ScannerOption) (*Scanner, error) {
+	if err := network.Validate(); err != nil {
+		return nil, err
+	}
+
+	identity, err := provider.Identity()
+	if err != nil {
+		return nil, fmt.Errorf("Can't get identity: %s", err)
+	}
+
+	if len(bootstrap) == 0 {
+		bootstrap = network.Bootstrap
+	}
 	ips, err := prepareBootstrap(bootstrap)
 	if err != nil {
 		return nil, err
@@ -62,11 +92,13 @@ func NewScanner(bootstrap []string, identity ffi.Identity, opts ...ScannerOption
 		return nil, fmt.Errorf("Empty bootstrap array")
 	}
 	scanner := &Scanner{
+		network:    network,
 		bootstrap:  ips,
 		identity:   identity,
 		result:     make(chan *protocol.Peer, 1024),
 		candidates: make(chan *Node, 1024),
-		stopped:    true,
+		queued:     make(map[string]struct{}),
+		versions:   network.Versions(),
 	}
 	for _, opt := range opts {
 		opt(scanner)
@@ -89,15 +121,22 @@ func NewScanner(bootstrap []string, identity ffi.Identity, opts ...ScannerOption
 
 // Scan -
 func (scanner *Scanner) Scan() {
+	scanner.ScanContext(context.Background())
+}
+
+// ScanContext - starts scanning which is stopped when the context is done. Connections in progress are interrupted.
+func (scanner *Scanner) ScanContext(ctx context.Context) {
+	scanner.ctx, scanner.cancel = context.WithCancel(ctx)
+
 	for _, ip := range scanner.bootstrap {
 		peer := &protocol.Peer{
 			Address: net.TCPAddr{
-				Port: 9732,
+				Port: scanner.network.P2PPort,
 				IP:   ip,
 			},
 		}
-		scanner.candidates <- NewNode(peer, scanner.attemptsDuration, scanner.dropAfter, scanner.syncedTime)
-
+		scanner.queued[ip.String()] = struct{}{}
+		scanner.candidates <- scanner.newNode(peer)
 	}
 
 	for i := int64(0); i < scanner.threadsCount; i++ {
@@ -105,7 +144,43 @@ func (scanner *Scanner) Scan() {
 		go scanner.process()
 	}
 
-	scanner.stopped = false
+	if scanner.listenPort != 0 {
+		if err := scanner.listen(); err != nil {
+			log.Printf("Listener is not started: %s", err)
+		}
+	}
+
+	go func() {
+		<-scanner.ctx.Done()
+		scanner.Stop()
+	}()
+}
+
+func (scanner *Scanner) newNode(peer *protocol.Peer) *Node {
+	node := NewNode(peer, scanner.attemptsDuration, scanner.dropAfter, scanner.syncedTime)
+	node.locator = scanner.locator
+	node.options = scanner.connectionOptions()
+	if scanner.dialer != nil {
+		node.dialer = scanner.dialer
+	}
+	node.powMode = scanner.powMode
+	node.powRequired = scanner.powRequired
+	node.versions = scanner.versions
+	return node
+}
+
+// connectionOptions - returns options of connections. The listening port is announced unless another port is set,
+// RPC is searched on the network's RPC port unless another port is set. Heads are requested for the network's chain.
+func (scanner *Scanner) connectionOptions() protocol.Options {
+	options := scanner.options
+	options.ChainID = scanner.network.ChainID
+	if options.ListeningPort == 0 {
+		options.ListeningPort = uint16(scanner.listenPort)
+	}
+	if options.RPCPort == 0 {
+		options.RPCPort = scanner.network.RPCPort
+	}
+	return options.WithDefaults()
 }
 
 // Listen -
@@ -113,15 +188,51 @@ func (scanner *Scanner) Listen() chan *protocol.Peer {
 	return scanner.result
 }
 
-// Stop -
+// Heads - returns scanned peers grouped by the hash of their current head.
+func (scanner *Scanner) Heads() map[crypto.BlockHash][]*protocol.Peer {
+	heads := make(map[crypto.BlockHash][]*protocol.Peer)
+	scanner.proofedPeers.Range(func(_, value interface{}) bool {
+		peer := value.(*protocol.Peer)
+		if peer.Head != nil {
+			heads[*peer.Head] = append(heads[*peer.Head], peer)
+		}
+		return true
+	})
+	return heads
+}
+
+// HeaviestHead - returns the head with the greatest fitness among scanned peers and peers which are at this head.
+// ok is false if no head has been received yet.
+func (scanner *Scanner) HeaviestHead() (head crypto.BlockHash, peers []*protocol.Peer, ok bool) {
+	var fitness protocol.RawFitness
+	for hash, headPeers := range scanner.Heads() {
+		if !ok || headPeers[0].Fitness.Compare(fitness) > 0 {
+			head, peers, fitness, ok = hash, headPeers, headPeers[0].Fitness, true
+		}
+	}
+	return
+}
+
+// Stop - stops scanning. Repeated calls do nothing.
 func (scanner *Scanner) Stop() {
-	scanner.stopped = true
+	scanner.stopOnce.Do(scanner.stopScanning)
+}
+
+func (scanner *Scanner) stopScanning() {
 	log.Print("Stopping scanner...")
+	if scanner.cancel != nil {
+		scanner.cancel()
+	}
+	if scanner.listener != nil {
+		scanner.listener.Close()
+		scanner.incoming.Wait()
+	}
 	for i := int64(0); i < scanner.threadsCount; i++ {
 		scanner.stop <- struct{}{}
 	}
-	close(scanner.candidates)
+	// candidates are closed when workers are finished, so they can't be enqueued to the closed channel
 	scanner.wg.Wait()
+	close(scanner.candidates)
 
 	close(scanner.result)
 	close(scanner.stop)
@@ -154,17 +265,20 @@ func (scanner *Scanner) processCandidate(candidate *Node) error {
 		return nil
 	}
 
-	peer, err := candidate.getPeer(scanner.identity)
+	peer, err := candidate.getPeer(scanner.ctx, scanner.identity)
 	if err != nil {
-		if scanner.stopped {
+		if scanner.ctx.Err() != nil {
 			return nil
 		}
 
-		scanner.mutex.Lock()
-		defer scanner.mutex.Unlock()
+		// rejecting peers propose other points instead of them
+		var nack *protocol.NackError
+		if errors.As(err, &nack) {
+			scanner.enqueue(protocol.PeersFromPoints(nack.Points))
+		}
 
 		if candidate.hasAttempts() {
-			scanner.candidates <- candidate
+			scanner.push(candidate)
 			return nil
 		}
 
@@ -175,23 +289,62 @@ func (scanner *Scanner) processCandidate(candidate *Node) error {
 		return err
 	}
 
-	neighbors, err := peer.GetPeersAddresses()
+	neighbors, err := peer.GetPeersAddressesContext(scanner.ctx)
 	if err != nil {
 		log.Printf("[GetPeersAddresses] %s", err)
 		return err
 	}
 
-	if scanner.stopped {
+	if scanner.ctx.Err() != nil {
 		return nil
 	}
 
-	scanner.mutex.Lock()
-	defer scanner.mutex.Unlock()
-
 	scanner.proofedPeers.Store(peer.Address.IP.String(), peer)
 	scanner.result <- peer
-	for _, newPeer := range neighbors {
-		scanner.candidates <- NewNode(newPeer, scanner.attemptsDuration, scanner.dropAfter, scanner.syncedTime)
-	}
+	scanner.enqueue(neighbors)
+	scanner.enqueue(protocol.PeersFromPoints(peer.Session().SwapPoints()))
 	return nil
 }
+
+// enqueue - adds peers to candidates skipping scanned and already queued IPs.
+// Only the bookkeeping is done under the mutex, candidates are sent after it's released.
+func (scanner *Scanner) enqueue(peers []*protocol.Peer) {
+	scanner.mutex.Lock()
+	nodes := make([]*Node, 0, len(peers))
+	for _, peer := range peers {
+		ip := peer.Address.IP.String()
+		if _, ok := scanner.proofedPeers.Load(ip); ok {
+			continue
+		}
+		if _, ok := scanner.queued[ip]; ok {
+			continue
+		}
+		scanner.queued[ip] = struct{}{}
+		nodes = append(nodes, scanner.newNode(peer))
+	}
+	scanner.mutex.Unlock()
+
+	for _, node := range nodes {
+		scanner.push(node)
+	}
+}
+
+// push - sends the candidate to workers. It's called by workers and incoming handlers which are awaited by Stop,
+// so the channel isn't closed meanwhile. If the channel is full, workers may be blocked on it,
+// so the candidate waits in its own goroutine until there is room or scanning is stopped.
+func (scanner *Scanner) push(candidate *Node) {
+	select {
+	case scanner.candidates <- candidate:
+		return
+	default:
+	}
+
+	scanner.wg.Add(1)
+	go func() {
+		defer scanner.wg.Done()
+		select {
+		case scanner.candidates <- candidate:
+		case <-scanner.ctx.Done():
+		}
+	}()
+}
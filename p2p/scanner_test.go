@@ -0,0 +1,121 @@
+package p2p
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/identity"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/networks"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/p2ptest"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
+)
+
+func TestScannerWithFakeNodes(t *testing.T) {
+	// scanner distinguishes peers by IP, so the fake nodes listen on different loopback addresses
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("127.0.0.2 is not available: %s", err)
+	}
+	listener.Close()
+
+	head := protocol.BlockHeader{
+		Level:     100,
+		Timestamp: time.Now().Unix(),
+	}
+	neighbor := p2ptest.Start(t, p2ptest.Config{
+		Address: "127.0.0.2:0",
+		Head:    head,
+	})
+	bootstrap := p2ptest.Start(t, p2ptest.Config{
+		Head:      head,
+		Neighbors: []string{neighbor.Point()},
+	})
+
+	network := networks.Mainnet
+	network.P2PPort = bootstrap.Addr().Port
+	scanner, err := NewScanner(network, []string{"127.0.0.1"}, identity.NewEphemeralProvider(0), WithThreadsCount(2), WithDropAfter(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !scanner.IsStopped() {
+		t.Errorf("scanner isn't started, but it's not stopped")
+	}
+	scanner.Scan()
+	defer scanner.Stop()
+	if scanner.IsStopped() {
+		t.Errorf("scanner is stopped after start")
+	}
+
+	scanned := make(map[string]*protocol.Peer)
+	timeout := time.After(10 * time.Second)
+	for len(scanned) < 2 {
+		select {
+		case peer := <-scanner.Listen():
+			scanned[peer.Address.IP.String()] = peer
+		case <-timeout:
+			t.Fatalf("scanned %d of 2 peers", len(scanned))
+		}
+	}
+
+	for ip, peer := range scanned {
+		if peer.Error != nil {
+			t.Errorf("%s: %s", ip, peer.Error)
+			continue
+		}
+		if peer.Level != head.Level {
+			t.Errorf("%s: %d != %d", ip, peer.Level, head.Level)
+		}
+	}
+	if peer, ok := scanned["127.0.0.2"]; ok && peer.ID != neighbor.PeerID() {
+		t.Errorf("%s != %s", peer.ID, neighbor.PeerID())
+	}
+
+	scanner.Stop()
+	if !scanner.IsStopped() {
+		t.Errorf("scanner is not stopped")
+	}
+}
+
+func TestScannerEnqueue(t *testing.T) {
+	scanner, err := NewScanner(networks.Mainnet, []string{"127.0.0.1"}, identity.NewEphemeralProvider(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cancel context.CancelFunc
+	scanner.ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	scanner.proofedPeers.Store("10.0.0.1", &protocol.Peer{})
+	scanner.enqueue(protocol.PeersFromPoints([]string{"10.0.0.1:9732", "10.0.0.2:9732", "10.0.0.2:9733", "10.0.0.3:9732"}))
+	scanner.enqueue(protocol.PeersFromPoints([]string{"10.0.0.3:9732"}))
+	if len(scanner.candidates) != 2 {
+		t.Errorf("%d != 2", len(scanner.candidates))
+	}
+
+	// enqueue doesn't block on the full channel, the rest candidates are sent when workers take the first ones
+	scanner.candidates = make(chan *Node, 1)
+	done := make(chan struct{})
+	go func() {
+		scanner.enqueue(protocol.PeersFromPoints([]string{"10.0.0.4:9732", "10.0.0.5:9732", "10.0.0.6:9732"}))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("enqueue is blocked")
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-scanner.candidates:
+		case <-time.After(time.Second):
+			t.Fatalf("candidate %d is not received", i)
+		}
+	}
+
+	// waiting candidates are dropped when scanning is stopped
+	scanner.enqueue(protocol.PeersFromPoints([]string{"10.0.0.7:9732", "10.0.0.8:9732"}))
+	cancel()
+	scanner.wg.Wait()
+}
@@ -0,0 +1,283 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/identity"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/networks"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/p2ptest"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/protocol"
+)
+
+// Simulation - virtual network of fake nodes. Every node has its own loopback IP of 127.1.0.0/16 and all nodes share
+// one port, because the scanner distinguishes peers by IP and dials bootstrap IPs on the network port.
+// The simulation is run once, then it has to be closed.
+type Simulation struct {
+	topology Topology
+	network  networks.Network
+	points   []string
+	nodes    []*p2ptest.Node
+	indices  map[string]int
+}
+
+// Report - comparison of the crawl with the ground truth. Nodes are referred by their indices in the topology.
+type Report struct {
+	Duration time.Duration `json:"duration"`
+	// Expected - nodes which the scanner has to discover, see Completeness.
+	Expected []int `json:"expected"`
+	// Discovered - nodes which are scanned successfully.
+	Discovered []int `json:"discovered"`
+	// Missed - expected nodes which aren't discovered.
+	Missed []int `json:"missed"`
+	// Failed - nodes which are reported with error.
+	Failed []int `json:"failed"`
+	// Unexpected - reported addresses which don't belong to the topology.
+	Unexpected []string `json:"unexpected"`
+
+	ExpectedEdges   int `json:"expected_edges"`
+	DiscoveredEdges int `json:"discovered_edges"`
+
+	// Connections - connections which are accepted by fake nodes. Duplicates are connections to nodes beyond the first one.
+	Connections int `json:"connections"`
+	Duplicates  int `json:"duplicates"`
+}
+
+// Completeness - share of expected nodes which are discovered.
+func (report Report) Completeness() float64 {
+	if len(report.Expected) == 0 {
+		return 1
+	}
+	return float64(len(report.Expected)-len(report.Missed)) / float64(len(report.Expected))
+}
+
+// EdgeCompleteness - share of expected advertisements which are discovered.
+func (report Report) EdgeCompleteness() float64 {
+	if report.ExpectedEdges == 0 {
+		return 1
+	}
+	return float64(report.DiscoveredEdges) / float64(report.ExpectedEdges)
+}
+
+// String -
+func (report Report) String() string {
+	return fmt.Sprintf("nodes %d/%d (%.1f%%), edges %d/%d (%.1f%%), failed %d, unexpected %d, connections %d, duplicates %d, %s",
+		len(report.Expected)-len(report.Missed), len(report.Expected), report.Completeness()*100,
+		report.DiscoveredEdges, report.ExpectedEdges, report.EdgeCompleteness()*100,
+		len(report.Failed), len(report.Unexpected), report.Connections, report.Duplicates, report.Duration)
+}
+
+// nodeIP - loopback address of the node.
+func nodeIP(index int) net.IP {
+	return net.IPv4(127, 1, byte((index+1)>>8), byte(index+1))
+}
+
+// New - starts fake nodes of the topology.
+func New(topology Topology) (*Simulation, error) {
+	if err := topology.Validate(); err != nil {
+		return nil, err
+	}
+	if len(topology.Nodes) > 65000 {
+		return nil, fmt.Errorf("too many nodes: %d", len(topology.Nodes))
+	}
+
+	sim := &Simulation{
+		topology: topology,
+		network:  networks.Mainnet,
+		points:   make([]string, len(topology.Nodes)),
+		nodes:    make([]*p2ptest.Node, len(topology.Nodes)),
+		indices:  make(map[string]int, len(topology.Nodes)),
+	}
+
+	// the port is free on the first address, other nodes have their own addresses
+	port, err := freePort(nodeIP(0))
+	if err != nil {
+		return nil, err
+	}
+	sim.network.P2PPort = port
+	for i := range topology.Nodes {
+		sim.points[i] = net.JoinHostPort(nodeIP(i).String(), strconv.Itoa(port))
+		sim.indices[nodeIP(i).String()] = i
+	}
+
+	head := protocol.BlockHeader{
+		Level:     1,
+		Timestamp: time.Now().Unix(),
+	}
+	for i, spec := range topology.Nodes {
+		if spec.Unreachable {
+			continue
+		}
+		node, err := p2ptest.NewNode(p2ptest.Config{
+			Address:     sim.points[i],
+			Network:     &sim.network,
+			Head:        head,
+			Neighbors:   sim.advertised(i),
+			PrivateNode: spec.Private,
+			Behavior:    spec.Behavior,
+			NackMotive:  protocol.NackTooManyConnections,
+			Delay:       spec.Delay,
+		})
+		if err != nil {
+			sim.Close()
+			return nil, fmt.Errorf("node %d is not started: %w", i, err)
+		}
+		sim.nodes[i] = node
+	}
+	return sim, nil
+}
+
+func freePort(ip net.IP) (int, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// advertised - points which the node advertises. Private nodes aren't advertised.
+func (sim *Simulation) advertised(index int) []string {
+	points := make([]string, 0)
+	for _, edge := range sim.topology.Edges {
+		if edge.From == index && !sim.topology.Nodes[edge.To].Private {
+			points = append(points, sim.points[edge.To])
+		}
+	}
+	return points
+}
+
+// Network - network preset of the simulation. Its p2p port is the port of the nodes.
+func (sim *Simulation) Network() networks.Network {
+	return sim.network
+}
+
+// Point - address of the node.
+func (sim *Simulation) Point(index int) string {
+	return sim.points[index]
+}
+
+// Close - stops all nodes.
+func (sim *Simulation) Close() {
+	for _, node := range sim.nodes {
+		if node != nil {
+			node.Close()
+		}
+	}
+}
+
+// Run - crawls the network by the scanner with the options until no peer is reported during idle or the context is done.
+// Scanner retries unreachable peers without limit by default, so WithDropAfter is usually passed.
+func (sim *Simulation) Run(ctx context.Context, idle time.Duration, opts ...p2p.ScannerOption) (Report, error) {
+	bootstrap := make([]string, 0, len(sim.topology.Bootstrap))
+	for _, index := range sim.topology.Bootstrap {
+		bootstrap = append(bootstrap, nodeIP(index).String())
+	}
+	scanner, err := p2p.NewScanner(sim.network, bootstrap, identity.NewEphemeralProvider(0), opts...)
+	if err != nil {
+		return Report{}, err
+	}
+
+	start := time.Now()
+	for i, spec := range sim.topology.Nodes {
+		if node := sim.nodes[i]; spec.LeaveAfter > 0 && node != nil {
+			leave := time.AfterFunc(spec.LeaveAfter, func() {
+				node.Close()
+			})
+			defer leave.Stop()
+		}
+	}
+	scanner.ScanContext(ctx)
+
+	results := make(map[string]*protocol.Peer)
+	timer := time.NewTimer(idle)
+	defer timer.Stop()
+collect:
+	for {
+		select {
+		case peer, ok := <-scanner.Listen():
+			if !ok {
+				break collect
+			}
+			results[peer.Address.IP.String()] = peer
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(idle)
+		case <-timer.C:
+			break collect
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	// workers may be blocked on the full results channel, so it's drained while the scanner is stopping
+	go scanner.Stop()
+	for peer := range scanner.Listen() {
+		results[peer.Address.IP.String()] = peer
+	}
+
+	report := sim.compare(results)
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+func (sim *Simulation) compare(results map[string]*protocol.Peer) (report Report) {
+	expected, expectedEdges := sim.topology.expected()
+	report.ExpectedEdges = len(expectedEdges)
+
+	discovered := make(map[int]bool)
+	for ip, peer := range results {
+		index, ok := sim.indices[ip]
+		if !ok {
+			report.Unexpected = append(report.Unexpected, peer.Address.String())
+			continue
+		}
+		if peer.Error != nil {
+			report.Failed = append(report.Failed, index)
+			continue
+		}
+		discovered[index] = true
+		report.Discovered = append(report.Discovered, index)
+
+		for _, point := range peer.Neighbors {
+			host, _, err := net.SplitHostPort(point)
+			if err != nil {
+				continue
+			}
+			if to, ok := sim.indices[host]; ok && expectedEdges[Edge{From: index, To: to}] {
+				report.DiscoveredEdges++
+			}
+		}
+	}
+
+	for index := range expected {
+		report.Expected = append(report.Expected, index)
+		if !discovered[index] {
+			report.Missed = append(report.Missed, index)
+		}
+	}
+
+	for _, node := range sim.nodes {
+		if node == nil {
+			continue
+		}
+		accepted := node.Accepted()
+		report.Connections += accepted
+		if accepted > 1 {
+			report.Duplicates += accepted - 1
+		}
+	}
+
+	sort.Ints(report.Expected)
+	sort.Ints(report.Discovered)
+	sort.Ints(report.Missed)
+	sort.Ints(report.Failed)
+	sort.Strings(report.Unexpected)
+	return
+}
@@ -0,0 +1,114 @@
+package simulation
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p"
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/p2ptest"
+)
+
+func newSimulation(t *testing.T, topology Topology) *Simulation {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.1.0.2:0")
+	if err != nil {
+		t.Skipf("127.1.0.0/16 is not available: %s", err)
+	}
+	listener.Close()
+
+	sim, err := New(topology)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sim.Close)
+	return sim
+}
+
+func TestSimulation(t *testing.T) {
+	topology := Topology{
+		Nodes: []NodeSpec{
+			{},
+			{},
+			{},
+			{Behavior: p2ptest.Nack},
+			{Private: true},
+			{Unreachable: true},
+			{},
+			{},
+		},
+		Edges: []Edge{
+			{0, 1}, {0, 2}, {0, 3},
+			{1, 4},
+			{2, 5},
+			{3, 7},
+			{4, 0},
+			{5, 6},
+		},
+		Bootstrap: []int{0},
+	}
+	sim := newSimulation(t, topology)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	report, err := sim.Run(ctx, time.Second, p2p.WithDropAfter(1), p2p.WithThreadsCount(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(report)
+
+	if want := []int{0, 1, 2, 7}; !reflect.DeepEqual(report.Expected, want) {
+		t.Errorf("expected %v != %v", report.Expected, want)
+	}
+	if len(report.Missed) > 0 {
+		t.Errorf("missed: %v", report.Missed)
+	}
+	if report.ExpectedEdges != 4 || report.EdgeCompleteness() != 1 {
+		t.Errorf("edges %d/%d", report.DiscoveredEdges, report.ExpectedEdges)
+	}
+	if want := []int{3, 5}; !reflect.DeepEqual(report.Failed, want) {
+		t.Errorf("failed %v != %v", report.Failed, want)
+	}
+	if len(report.Unexpected) > 0 {
+		t.Errorf("unexpected: %v", report.Unexpected)
+	}
+}
+
+func TestRandomSimulation(t *testing.T) {
+	config := RandomConfig{
+		Nodes:       30,
+		Degree:      3,
+		Unreachable: 0.1,
+		Private:     0.1,
+		Nack:        0.1,
+		Churn:       0.1,
+		ChurnAfter:  500 * time.Millisecond,
+		Seed:        1,
+	}
+	topology := Random(config)
+	if !reflect.DeepEqual(topology, Random(config)) {
+		t.Errorf("topology of the same seed differs")
+	}
+	if len(topology.Edges) != config.Nodes*config.Degree {
+		t.Errorf("%d != %d", len(topology.Edges), config.Nodes*config.Degree)
+	}
+	sim := newSimulation(t, topology)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	report, err := sim.Run(ctx, time.Second, p2p.WithDropAfter(1), p2p.WithThreadsCount(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(report)
+
+	if report.Completeness() != 1 {
+		t.Errorf("missed: %v", report.Missed)
+	}
+	if len(report.Unexpected) > 0 {
+		t.Errorf("unexpected: %v", report.Unexpected)
+	}
+}
@@ -0,0 +1,173 @@
+// Package simulation - virtual tezos networks of fake loopback nodes which are built from a graph description
+// and crawled by p2p.Scanner to compare the discovered network with the ground truth.
+package simulation
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/aopoltorzhicky/tezos-scanner/p2p/p2ptest"
+)
+
+// NodeSpec - description of the virtual node.
+type NodeSpec struct {
+	// Unreachable - nothing listens on the node address.
+	Unreachable bool
+	// Private - the node announces itself as private, so its neighbours don't advertise it.
+	// It's discovered only if it's bootstrap.
+	Private bool
+	// Behavior and Delay are passed to the fake node. Nack nodes propose their neighbours instead of themselves.
+	Behavior p2ptest.Behavior
+	Delay    time.Duration
+	// LeaveAfter - the node goes offline when the duration has passed since the crawl start. Zero keeps the node online.
+	LeaveAfter time.Duration
+}
+
+// Edge - the node From advertises the node To.
+type Edge struct {
+	From int
+	To   int
+}
+
+// Topology - graph of the virtual network. Nodes are referred by their indices.
+type Topology struct {
+	Nodes     []NodeSpec
+	Edges     []Edge
+	Bootstrap []int
+}
+
+// Validate - checks that edges and bootstrap refer to existing nodes.
+func (topology Topology) Validate() error {
+	if len(topology.Nodes) == 0 {
+		return fmt.Errorf("topology is empty")
+	}
+	if len(topology.Bootstrap) == 0 {
+		return fmt.Errorf("bootstrap is empty")
+	}
+	check := func(index int) error {
+		if index < 0 || index >= len(topology.Nodes) {
+			return fmt.Errorf("unknown node %d", index)
+		}
+		return nil
+	}
+	for _, edge := range topology.Edges {
+		if err := check(edge.From); err != nil {
+			return err
+		}
+		if err := check(edge.To); err != nil {
+			return err
+		}
+	}
+	for _, index := range topology.Bootstrap {
+		if err := check(index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RandomConfig - parameters of the random topology. Shares of unreachable, private, nack and churning nodes
+// are taken from nodes which aren't bootstrap.
+type RandomConfig struct {
+	Nodes       int
+	Degree      int
+	Bootstrap   int
+	Unreachable float64
+	Private     float64
+	Nack        float64
+	Churn       float64
+	// ChurnAfter - maximum time after which churning nodes go offline. Default is 1 second.
+	ChurnAfter time.Duration
+	Seed       int64
+}
+
+// Random - generates the topology where every node advertises Degree random other nodes.
+// The same seed produces the same topology.
+func Random(config RandomConfig) Topology {
+	random := rand.New(rand.NewSource(config.Seed))
+	if config.Bootstrap == 0 {
+		config.Bootstrap = 1
+	}
+	if config.ChurnAfter == 0 {
+		config.ChurnAfter = time.Second
+	}
+
+	topology := Topology{
+		Nodes: make([]NodeSpec, config.Nodes),
+	}
+	for i := 0; i < config.Bootstrap && i < config.Nodes; i++ {
+		topology.Bootstrap = append(topology.Bootstrap, i)
+	}
+
+	for i := config.Bootstrap; i < config.Nodes; i++ {
+		spec := &topology.Nodes[i]
+		switch value := random.Float64(); {
+		case value < config.Unreachable:
+			spec.Unreachable = true
+		case value < config.Unreachable+config.Private:
+			spec.Private = true
+		case value < config.Unreachable+config.Private+config.Nack:
+			spec.Behavior = p2ptest.Nack
+		case value < config.Unreachable+config.Private+config.Nack+config.Churn:
+			spec.LeaveAfter = time.Duration(random.Int63n(int64(config.ChurnAfter)) + 1)
+		}
+	}
+
+	for i := 0; i < config.Nodes; i++ {
+		added := 0
+		for _, j := range random.Perm(config.Nodes) {
+			if added == config.Degree {
+				break
+			}
+			if j != i {
+				topology.Edges = append(topology.Edges, Edge{From: i, To: j})
+				added++
+			}
+		}
+	}
+	return topology
+}
+
+// expected - ground truth of the crawl. Nodes are discoverable if they are reachable from bootstrap by advertisements
+// of stable nodes, that are nodes which are online during the whole crawl and answer honestly or by nack.
+// Expected nodes are discoverable stable honest nodes, churning nodes may be discovered but aren't expected.
+// Expected edges are advertisements of expected nodes.
+func (topology Topology) expected() (nodes map[int]bool, edges map[Edge]bool) {
+	advertised := make(map[int][]int)
+	for _, edge := range topology.Edges {
+		if !topology.Nodes[edge.To].Private {
+			advertised[edge.From] = append(advertised[edge.From], edge.To)
+		}
+	}
+
+	stable := func(index int) bool {
+		spec := topology.Nodes[index]
+		return !spec.Unreachable && spec.LeaveAfter == 0 && (spec.Behavior == p2ptest.Honest || spec.Behavior == p2ptest.Nack)
+	}
+
+	nodes = make(map[int]bool)
+	edges = make(map[Edge]bool)
+	visited := make(map[int]bool)
+	queue := append([]int(nil), topology.Bootstrap...)
+	for len(queue) > 0 {
+		index := queue[0]
+		queue = queue[1:]
+		if visited[index] {
+			continue
+		}
+		visited[index] = true
+
+		if !stable(index) {
+			continue
+		}
+		if topology.Nodes[index].Behavior == p2ptest.Honest {
+			nodes[index] = true
+			for _, to := range advertised[index] {
+				edges[Edge{From: index, To: to}] = true
+			}
+		}
+		queue = append(queue, advertised[index]...)
+	}
+	return
+}
@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// prober - makes RPC requests and listener pings through the dialer.
+type prober struct {
+	dialer Dialer
+	client *http.Client
+}
+
+func newProber(dialer Dialer) *prober {
+	return &prober{
+		dialer: dialer,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext:       dialer.DialContext,
+				DisableKeepAlives: true,
+			},
+		},
+	}
+}
+
+// get - requests the RPC path and decodes JSON response to result.
+func (p *prober) get(ctx context.Context, timeout time.Duration, url string, result interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// ping - checks that the address accepts TCP connections.
+func (p *prober) ping(ctx context.Context, timeout time.Duration, address string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := p.dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	if conn == nil {
+		return fmt.Errorf("Listener connection is nil: %s", address)
+	}
+	return conn.Close()
+}
+
+// blockHeader - part of the response of /chains/main/blocks/head/header.
+type blockHeader struct {
+	ChainID string `json:"chain_id"`
+}
+
+// networkPoint - item of the response of /network/points which is encoded as [address, info] pair.
+type networkPoint struct {
+	URI   string
+	State pointState
+}
+
+type pointState struct {
+	EventKind string `json:"event_kind"`
+}
+
+// UnmarshalJSON -
+func (point *networkPoint) UnmarshalJSON(data []byte) error {
+	var pair [2]json.RawMessage
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(pair[0], &point.URI); err != nil {
+		return err
+	}
+	info := struct {
+		State *pointState `json:"state"`
+	}{&point.State}
+	return json.Unmarshal(pair[1], &info)
+}
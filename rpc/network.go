@@ -1,6 +1,7 @@
 package scanner
 
 import (
+	"context"
 	"log"
 	"net"
 	"net/url"
@@ -13,16 +14,24 @@ type Network struct {
 	Nodes []*Node
 
 	checked map[string]struct{}
-	chainID string
+	preset  Preset
+	dialer  Dialer
+	probe   *prober
 }
 
-// NewNetwork -
-func NewNetwork(chainID string) *Network {
-	return &Network{
+// NewNetwork - preset defines chain ID which is checked and RPC port of nodes.
+func NewNetwork(preset Preset, opts ...NetworkOption) *Network {
+	network := &Network{
 		Nodes:   make([]*Node, 0),
 		checked: make(map[string]struct{}),
-		chainID: chainID,
+		preset:  preset,
+		dialer:  &net.Dialer{},
 	}
+	for _, opt := range opts {
+		opt(network)
+	}
+	network.probe = newProber(network.dialer)
+	return network
 }
 
 // Init -
@@ -54,57 +63,68 @@ func (network *Network) Init(bootstrap []string) {
 
 // Scan -
 func (network *Network) Scan() error {
+	return network.ScanContext(context.Background())
+}
+
+// ScanContext - scans the network until the context is done. The context error is returned if scanning is interrupted.
+func (network *Network) ScanContext(ctx context.Context) error {
 	start := time.Now()
 	for i := range network.Nodes {
-		if err := network.findNeighbors(network.Nodes[i]); err != nil {
+		if err := network.findNeighbors(ctx, network.Nodes[i]); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			log.Printf("[ERROR] %s", err)
 		}
 	}
 
 	log.Printf("Spent: %s", time.Since(start))
-	return nil
+	return ctx.Err()
 }
 
-func (network *Network) findNeighbors(node *Node) error {
+func (network *Network) findNeighbors(ctx context.Context, node *Node) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if _, ok := network.checked[node.IP]; ok {
 		return nil
 	}
-	if err := node.findNeighbors(); err != nil {
+	if err := node.findNeighbors(ctx, network.probe); err != nil {
 		network.checked[node.IP] = struct{}{}
 		return err
 	}
 
-	network.pingNodes(node.Neighbors)
+	network.pingNodes(ctx, node.Neighbors)
 
 	network.checked[node.IP] = struct{}{}
 	network.Nodes = append(network.Nodes, node)
 
 	for i := range node.Neighbors {
-		if err := network.findNeighbors(node.Neighbors[i]); err != nil {
+		if err := network.findNeighbors(ctx, node.Neighbors[i]); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (network *Network) pingNodes(nodes []*Node) {
+func (network *Network) pingNodes(ctx context.Context, nodes []*Node) {
 	var wg sync.WaitGroup
 
 	for _, node := range nodes {
 		wg.Add(1)
-		go network.pingNode(node, &wg)
+		go network.pingNode(ctx, node, &wg)
 	}
 	wg.Wait()
 }
 
-func (network *Network) pingNode(node *Node, wg *sync.WaitGroup) {
+func (network *Network) pingNode(ctx context.Context, node *Node, wg *sync.WaitGroup) {
 	defer wg.Done()
-	if err := node.checkHead(network.chainID); err != nil {
+	if err := node.checkHead(ctx, network.probe, network.preset.ChainID, network.preset.RPCPort); err != nil {
 		// log.Printf("[WARNING] check head: (%s) %s", node.ip, err)
 		return
 	}
 
-	if err := node.pingListener(); err != nil {
+	if err := node.pingListener(ctx, network.probe); err != nil {
 		// log.Printf("[WARNING] ping listener: (%s) %s", node.ip, err)
 		return
 	}
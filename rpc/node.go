@@ -1,11 +1,11 @@
 package scanner
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
-
-	"github.com/romanserikov/tzgo"
 )
 
 // Node -
@@ -50,14 +50,16 @@ func (n *Node) IsAlive() bool {
 	return n.RPCURI != ""
 }
 
-func (n *Node) findNeighbors() error {
+func (n *Node) findNeighbors(ctx context.Context, probe *prober) error {
 	if !n.IsAlive() {
 		return nil
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	node := tzgo.NewTezosNode(n.RPCURI, 5*time.Second)
-	points, err := node.NetworkPoints()
-	if err != nil {
+	var points []networkPoint
+	if err := probe.get(ctx, 5*time.Second, n.RPCURI+"/network/points", &points); err != nil {
 		return fmt.Errorf("%s: %s", n, err)
 	}
 
@@ -80,14 +82,16 @@ func (n *Node) findNeighbors() error {
 	return nil
 }
 
-func (n *Node) checkHead(chainID string) error {
-	ports := []int{8732, 80}
+func (n *Node) checkHead(ctx context.Context, probe *prober, chainID string, rpcPort int) error {
+	ports := []int{rpcPort, 80}
 	for _, port := range ports {
-		baseURL := fmt.Sprintf("http://%s:%d", n.IP, port)
-		node := tzgo.NewTezosNode(baseURL, 2*time.Second)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		baseURL := fmt.Sprintf("http://%s", net.JoinHostPort(n.IP, strconv.Itoa(port)))
 
-		block, err := node.Head()
-		if err != nil {
+		var block blockHeader
+		if err := probe.get(ctx, 2*time.Second, baseURL+"/chains/main/blocks/head/header", &block); err != nil {
 			// log.Printf("[WARNING] %s: %s", baseURL, err)
 			continue
 		}
@@ -102,17 +106,10 @@ func (n *Node) checkHead(chainID string) error {
 	return nil
 }
 
-func (n *Node) pingListener() error {
-	conn, err := net.DialTimeout("tcp", n.ListenerURI, time.Second)
-	if err != nil {
+func (n *Node) pingListener(ctx context.Context, probe *prober) error {
+	if err := probe.ping(ctx, time.Second, n.ListenerURI); err != nil {
 		n.ListenerURI = ""
 		return err
 	}
-
-	if conn == nil {
-		n.ListenerURI = ""
-		return fmt.Errorf("Listener connection is nil: %s", n.ListenerURI)
-	}
-	conn.Close()
 	return nil
 }
@@ -1,5 +1,10 @@
 package scanner
 
+import (
+	"context"
+	"net"
+)
+
 // NodeOption -
 type NodeOption func(*Node)
 
@@ -16,3 +21,18 @@ func WithListenerURL(url string) NodeOption {
 		node.ListenerURI = url
 	}
 }
+
+// Dialer - establishes connections of RPC requests and listener pings. Dialers of the p2p dialer package satisfy it.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// NetworkOption -
+type NetworkOption func(*Network)
+
+// WithDialer - sets how RPC requests and listener pings reach nodes, for example through SOCKS5 proxy or Tor. Default is direct dial.
+func WithDialer(dialer Dialer) NetworkOption {
+	return func(network *Network) {
+		network.dialer = dialer
+	}
+}
@@ -0,0 +1,24 @@
+package scanner
+
+// Preset - chain parameters which are checked by RPC scanner. They duplicate p2p network presets,
+// so the rpc module doesn't depend on the p2p module.
+type Preset struct {
+	Name    string
+	ChainID string
+	RPCPort int
+}
+
+// Built-in presets
+var (
+	Mainnet = Preset{
+		Name:    "mainnet",
+		ChainID: "NetXdQprcVkpaWU",
+		RPCPort: 8732,
+	}
+
+	Ghostnet = Preset{
+		Name:    "ghostnet",
+		ChainID: "NetXnHfVqm9iesp",
+		RPCPort: 8732,
+	}
+)